@@ -12,7 +12,9 @@ func (s *Server) authenticate(next http.Handler) http.Handler {
 			apiKey = r.URL.Query().Get("api_key")
 		}
 
-		if apiKey != os.Getenv("API_KEY") {
+		// Without a configured key, protected endpoints stay closed
+		expected := os.Getenv("API_KEY")
+		if expected == "" || apiKey != expected {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
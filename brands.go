@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// brandMinScore is the lowest score kept as a domain's brand match. It is
+// below every threshold /similarity offers so nothing it serves is lost.
+const brandMinScore = 60
+
+// Brand is a domain we look for lookalikes of.
+type Brand struct {
+	Domain   string // e.g. paypal.com
+	Label    string // the domain without its TLD, which is what is compared
+	Skeleton string // of Label, see skeleton
+}
+
+// BrandMatch is the brand a domain is closest to. Each similarity is from 0
+// to 100 and Score is their mean.
+type BrandMatch struct {
+	Brand       string  `json:"brand"`
+	Score       float64 `json:"score"`
+	Levenshtein float64 `json:"levenshtein"`
+	Damerau     float64 `json:"damerau"`
+	JaroWinkler float64 `json:"jaro_winkler"`
+	Keyboard    float64 `json:"keyboard"`
+}
+
+// loadBrands reads one brand domain per line, see parseBrand.
+func loadBrands(path string) ([]Brand, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var brands []Brand
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		brand, err := parseBrand(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		if seen[brand.Domain] {
+			continue
+		}
+		seen[brand.Domain] = true
+		brands = append(brands, brand)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return brands, nil
+}
+
+// parseBrand reads a brand domain, taking a bare name such as "acme" as
+// acme.com.
+func parseBrand(v string) (Brand, error) {
+	if !strings.Contains(v, ".") {
+		v += ".com"
+	}
+
+	name, err := normalizeDomain(v)
+	if err == nil {
+		err = validateHostname(name)
+	}
+	if err != nil {
+		return Brand{}, err
+	}
+
+	label := strings.TrimSuffix(name, "."+publicSuffixes.PublicSuffix(name))
+	return Brand{Domain: name, Label: label, Skeleton: skeleton(label)}, nil
+}
+
+// matchBrand scores d against every brand and returns the best match, or
+// nil if none reaches brandMinScore. A brand's own domain never matches.
+func matchBrand(d *Domain, brands []Brand) *BrandMatch {
+	label := nameLabel(d)
+
+	var best *BrandMatch
+	for _, brand := range brands {
+		if d.Name == brand.Domain {
+			continue
+		}
+
+		// Levenshtein similarity bounds the other three closely enough
+		// that names more than half different are never worth scoring
+		longest := max(len(label), len(brand.Label))
+		limit := longest / 2
+		lev := levenshteinWithin(label, brand.Label, limit)
+		if lev > limit {
+			continue
+		}
+
+		m := &BrandMatch{
+			Brand:       brand.Domain,
+			Levenshtein: similarity(float64(lev), longest),
+			Damerau:     similarity(float64(damerau(label, brand.Label)), longest),
+			JaroWinkler: round(100 * jaroWinkler(label, brand.Label)),
+			Keyboard:    similarity(keyboardDistance(label, brand.Label), longest),
+		}
+		m.Score = round((m.Levenshtein + m.Damerau + m.JaroWinkler + m.Keyboard) / 4)
+
+		if m.Score >= brandMinScore && (best == nil || m.Score > best.Score) {
+			best = m
+		}
+	}
+	return best
+}
+
+// similarity turns an edit distance into a percentage of the longer name.
+func similarity(distance float64, longest int) float64 {
+	if longest == 0 {
+		return 100
+	}
+	return round(100 * (1 - distance/float64(longest)))
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// scoreDomains sets BrandMatch, Confusable, Combo and Risk on domains,
+// skipping those where skip is true. lookup returns what lookups found about
+// domains[i]. The work is spread over every CPU since it runs over the whole
+// feed.
+func scoreDomains(domains []Domain, brands []Brand, skip []bool, lookup func(i int) lookupSummary) {
+	workers := runtime.NumCPU()
+	chunk := (len(domains) + workers - 1) / workers
+	vocab := newComboVocabulary(brands, lures)
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(domains); start += chunk {
+		end := min(start+chunk, len(domains))
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				if skip == nil || !skip[i] {
+					domains[i].BrandMatch = matchBrand(&domains[i], brands)
+					domains[i].Confusable = matchConfusable(&domains[i], brands)
+					domains[i].Combo = matchCombo(&domains[i], vocab)
+					domains[i].Risk = riskScorer.assess(&domains[i], lookup(i))
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+}
+
+// scoreNewDomains scores the domains of a fetch that aren't in the current
+// snapshot and carries over the scores of those that are.
+func (s *Server) scoreNewDomains(domains []Domain) {
+	known := make([]bool, len(domains))
+	lookups := make(map[int]lookupSummary)
+	s.mu.RLock()
+	for i := range domains {
+		if j, ok := s.index[domains[i].Name]; ok {
+			domains[i].BrandMatch = s.domains[j].BrandMatch
+			domains[i].Confusable = s.domains[j].Confusable
+			domains[i].Combo = s.domains[j].Combo
+			domains[i].Risk = s.domains[j].Risk
+			known[i] = true
+		} else if l, ok := s.lookups[domains[i].Name]; ok {
+			lookups[i] = l
+		}
+	}
+	s.mu.RUnlock()
+
+	scoreDomains(domains, s.brands, known, func(i int) lookupSummary { return lookups[i] })
+}
+
+// rescoreDomains scores every domain again, for when the brand list or risk
+// weights may have changed since the domains were stored.
+func (s *Server) rescoreDomains() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scoreDomains(s.domains, s.brands, nil, func(i int) lookupSummary {
+		return s.lookups[s.domains[i].Name]
+	})
+}
+
+// brandSimilarity groups domains by the brand they resemble, keeping those
+// scoring at least threshold, in the shape of the upstream similarity files.
+func (s *Server) brandSimilarity(threshold float64) *CachedData {
+	lookalikes := make(map[string][]Lookalike)
+
+	s.mu.RLock()
+	for i := range s.domains {
+		m := s.domains[i].BrandMatch
+		if m != nil && m.Score >= threshold {
+			lookalikes[m.Brand] = append(lookalikes[m.Brand], Lookalike{Domain: s.domains[i].Name, Similarity: m.Score})
+		}
+	}
+	s.mu.RUnlock()
+
+	return newCachedData(lookalikes)
+}
+
+// parseThreshold reads a /similarity threshold as a percentage.
+func parseThreshold(v string) (float64, error) {
+	threshold, err := strconv.ParseFloat(v, 64)
+	if err != nil || threshold < 0 || threshold > 100 {
+		return 0, fmt.Errorf("threshold must be a percentage between 0 and 100")
+	}
+	return threshold, nil
+}
@@ -47,6 +47,19 @@ func (c *Cache) Get(key string) (interface{}, bool) {
 	return item.Value, true
 }
 
+// Items returns a copy of every entry that hasn't expired.
+func (c *Cache) Items() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make(map[string]interface{}, len(c.items))
+	for key, item := range c.items {
+		if time.Now().Before(item.Expiration) {
+			items[key] = item.Value
+		}
+	}
+	return items
+}
+
 func (c *Cache) cleanup() {
 	ticker := time.NewTicker(time.Minute)
 	for range ticker.C {
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+//go:embed data/lures.txt
+var embeddedLures string
+
+// lures are the words phishing domains add to a brand name. They can be
+// replaced at startup using -lures.
+var lures = mustParseWordList(strings.NewReader(embeddedLures))
+
+// comboMinInline is the shortest brand name found inside a longer word.
+// Shorter ones only count between hyphens, or hp would be found in shopping.
+const comboMinInline = 4
+
+// ComboMatch is a brand name found in a domain alongside lure words, as in
+// paypal-secure-login.com.
+type ComboMatch struct {
+	Brand  string   `json:"brand"`
+	Tokens []string `json:"tokens"` // the name split into words
+	Lures  []string `json:"lures"`
+}
+
+func loadLures(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseWordList(f)
+}
+
+func mustParseWordList(r io.Reader) []string {
+	words, err := parseWordList(r)
+	if err != nil {
+		panic(err)
+	}
+	return words
+}
+
+// parseWordList reads one word per line, skipping blank lines and comments.
+func parseWordList(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		for _, c := range word {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+				return nil, fmt.Errorf("line %d: %q is not a word of letters and digits", n, word)
+			}
+		}
+		words = append(words, word)
+	}
+	return words, scanner.Err()
+}
+
+type comboWord struct {
+	text  string // with any hyphens removed
+	brand string // the brand's domain, empty for lures
+}
+
+// comboVocabulary holds the brand names and lures by first letter.
+type comboVocabulary map[byte][]comboWord
+
+func newComboVocabulary(brands []Brand, lures []string) comboVocabulary {
+	v := make(comboVocabulary)
+	known := make(map[string]bool)
+	// Brands first, so a brand that is also a lure counts as the brand
+	for _, brand := range brands {
+		text := strings.ReplaceAll(brand.Label, "-", "")
+		if text != "" && !strings.Contains(text, ".") && !known[text] {
+			known[text] = true
+			v[text[0]] = append(v[text[0]], comboWord{text: text, brand: brand.Domain})
+		}
+	}
+	for _, lure := range lures {
+		if !known[lure] {
+			known[lure] = true
+			v[lure[0]] = append(v[lure[0]], comboWord{text: lure})
+		}
+	}
+	return v
+}
+
+func isWordBreak(c byte) bool {
+	return c == '-' || c == '.'
+}
+
+// matchWord returns how many bytes of s from i spell w, allowing hyphens
+// inside it so bank-of-america matches bankofamerica, or -1.
+func matchWord(s string, i int, w string) int {
+	j := i
+	for k := 0; k < len(w); k++ {
+		for k > 0 && j < len(s) && s[j] == '-' {
+			j++
+		}
+		if j >= len(s) || s[j] != w[k] {
+			return -1
+		}
+		j++
+	}
+	return j - i
+}
+
+// comboToken is a word of a segmented name; word is nil if it isn't known.
+type comboToken struct {
+	text string
+	word *comboWord
+}
+
+// segment splits label into the known words covering as much of it as
+// possible, in as few words as possible. Hyphens and dots always break
+// words and what is left between known words becomes words of its own.
+func (v comboVocabulary) segment(label string) []comboToken {
+	type step struct {
+		covered, words int
+		from           int
+		word           *comboWord
+	}
+	n := len(label)
+	best := make([]step, n+1)
+	for i := 1; i <= n; i++ {
+		best[i].covered = -1
+	}
+	relax := func(to, from, covered, words int, w *comboWord) {
+		b := &best[to]
+		if covered > b.covered || (covered == b.covered && words < b.words) {
+			*b = step{covered: covered, words: words, from: from, word: w}
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		cur := best[i]
+		relax(i+1, i, cur.covered, cur.words, nil)
+		if isWordBreak(label[i]) {
+			continue
+		}
+		atStart := i == 0 || isWordBreak(label[i-1])
+		words := v[label[i]]
+		for k := range words {
+			w := &words[k]
+			l := matchWord(label, i, w.text)
+			if l < 0 {
+				continue
+			}
+			end := i + l
+			if w.brand != "" && len(w.text) < comboMinInline && !(atStart && (end == n || isWordBreak(label[end]))) {
+				continue
+			}
+			relax(end, i, cur.covered+len(w.text), cur.words+1, w)
+		}
+	}
+
+	// Walk back from the end, gathering unknown characters into words
+	var tokens []comboToken
+	var unknown []byte
+	flush := func() {
+		if len(unknown) > 0 {
+			for a, b := 0, len(unknown)-1; a < b; a, b = a+1, b-1 {
+				unknown[a], unknown[b] = unknown[b], unknown[a]
+			}
+			tokens = append(tokens, comboToken{text: string(unknown)})
+			unknown = nil
+		}
+	}
+	for i := n; i > 0; {
+		b := best[i]
+		switch {
+		case b.word != nil:
+			flush()
+			tokens = append(tokens, comboToken{text: label[b.from:i], word: b.word})
+		case isWordBreak(label[b.from]):
+			flush()
+		default:
+			unknown = append(unknown, label[b.from])
+		}
+		i = b.from
+	}
+	flush()
+
+	for a, b := 0, len(tokens)-1; a < b; a, b = a+1, b-1 {
+		tokens[a], tokens[b] = tokens[b], tokens[a]
+	}
+	return tokens
+}
+
+// matchCombo looks for a brand name and at least one lure among the words
+// of d's name.
+func matchCombo(d *Domain, vocab comboVocabulary) *ComboMatch {
+	var m ComboMatch
+	for _, t := range vocab.segment(nameLabel(d)) {
+		m.Tokens = append(m.Tokens, t.text)
+		switch {
+		case t.word == nil:
+		case t.word.brand != "":
+			if m.Brand == "" {
+				m.Brand = t.word.brand
+			}
+		case !slices.Contains(m.Lures, t.word.text):
+			m.Lures = append(m.Lures, t.word.text)
+		}
+	}
+
+	if m.Brand == "" || len(m.Lures) == 0 || d.Name == m.Brand {
+		return nil
+	}
+	return &m
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchCombo(t *testing.T) {
+	var brands []Brand
+	for _, v := range []string{"paypal.com", "apple.com", "bankofamerica.com", "hp.com", "chase.com"} {
+		brand, err := parseBrand(v)
+		if err != nil {
+			t.Fatalf("parseBrand(%q): %v", v, err)
+		}
+		brands = append(brands, brand)
+	}
+	vocab := newComboVocabulary(brands, []string{"secure", "login", "verify", "support", "account", "alert", "refund", "shop"})
+
+	tests := []struct {
+		name   string
+		brand  string // empty for no match
+		tokens []string
+		lures  []string
+	}{
+		// Unhyphenated and hyphenated forms of the same combination
+		{"paypalsecurelogin.com", "paypal.com", []string{"paypal", "secure", "login"}, []string{"secure", "login"}},
+		{"paypal-secure-login.com", "paypal.com", []string{"paypal", "secure", "login"}, []string{"secure", "login"}},
+		{"secure-paypal.net", "paypal.com", []string{"secure", "paypal"}, []string{"secure"}},
+		{"login.paypal-verify.com", "paypal.com", []string{"login", "paypal", "verify"}, []string{"login", "verify"}},
+		// Unknown text between known words becomes its own token
+		{"paypal-xyz-support.com", "paypal.com", []string{"paypal", "xyz", "support"}, []string{"support"}},
+		{"mypaypalaccount.com", "paypal.com", []string{"my", "paypal", "account"}, []string{"account"}},
+		// A brand name spelled with hyphens
+		{"bank-of-america-alert.com", "bankofamerica.com", []string{"bank-of-america", "alert"}, []string{"alert"}},
+		{"bankofamericarefund.co.uk", "bankofamerica.com", []string{"bankofamerica", "refund"}, []string{"refund"}},
+		// Short brands only count as whole hyphenated words, so hp inside
+		// shopping isn't a match even with a lure next to it
+		{"hp-support.com", "hp.com", []string{"hp", "support"}, []string{"support"}},
+		{"shopping-login.com", "", nil, nil},
+		{"hpsupport.com", "", nil, nil},
+
+		// A brand without lures, lures without a brand and the brand's
+		// own domain aren't combosquats
+		{"paypal.net", "", nil, nil},
+		{"secure-login.com", "", nil, nil},
+		{"apple.com", "", nil, nil},
+		// Longer brands inside another word need a lure to match
+		{"purchasedetails.com", "", nil, nil},
+		{"chasetheshop.com", "chase.com", []string{"chase", "the", "shop"}, []string{"shop"}},
+		{"pineapplerefund.com", "apple.com", []string{"pine", "apple", "refund"}, []string{"refund"}},
+	}
+
+	for _, tt := range tests {
+		d, err := parseDomain(tt.name)
+		if err != nil {
+			t.Errorf("parseDomain(%q): %v", tt.name, err)
+			continue
+		}
+
+		m := matchCombo(&d, vocab)
+		switch {
+		case tt.brand == "" && m != nil:
+			t.Errorf("%s matched %+v, want no match", tt.name, m)
+		case tt.brand == "":
+		case m == nil:
+			t.Errorf("%s didn't match, want %s", tt.name, tt.brand)
+		case m.Brand != tt.brand || !slices.Equal(m.Tokens, tt.tokens) || !slices.Equal(m.Lures, tt.lures):
+			t.Errorf("%s = %s %v %v, want %s %v %v", tt.name, m.Brand, m.Tokens, m.Lures, tt.brand, tt.tokens, tt.lures)
+		}
+	}
+}
+
+func TestParseWordList(t *testing.T) {
+	words, err := parseWordList(strings.NewReader("# lures\nLogin\n\n  secure \nverify2\n"))
+	if err != nil || !slices.Equal(words, []string{"login", "secure", "verify2"}) {
+		t.Errorf("parseWordList = %v, %v", words, err)
+	}
+	if _, err := parseWordList(strings.NewReader("log-in\n")); err == nil {
+		t.Errorf("parseWordList accepted a word with a hyphen")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//go:embed data/confusables.txt
+var embeddedConfusables string
+
+// confusables maps a character to its UTS #39 prototype. It can be replaced
+// at startup with the full confusables.txt using -confusables.
+var confusables = mustParseConfusables(strings.NewReader(embeddedConfusables))
+
+func loadConfusables(path string) (map[rune]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseConfusables(f)
+}
+
+func mustParseConfusables(r io.Reader) map[rune]string {
+	table, err := parseConfusables(r)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// parseConfusables reads lines of the form "0430 ; 0061 ; MA # comment".
+func parseConfusables(r io.Reader) (map[rune]string, error) {
+	table := make(map[rune]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		// The published file starts with a byte order mark
+		line = strings.TrimSpace(strings.TrimPrefix(line, "\uFEFF"))
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected source ; prototype", n)
+		}
+		source, err := parseCodePoints(fields[0])
+		if err != nil || utf8.RuneCountInString(source) != 1 {
+			return nil, fmt.Errorf("line %d: invalid source %q", n, strings.TrimSpace(fields[0]))
+		}
+		prototype, err := parseCodePoints(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		table[[]rune(source)[0]] = prototype
+	}
+	return table, scanner.Err()
+}
+
+func parseCodePoints(field string) (string, error) {
+	var b strings.Builder
+	for _, hex := range strings.Fields(field) {
+		cp, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid code point %q", hex)
+		}
+		b.WriteRune(rune(cp))
+	}
+	return b.String(), nil
+}
+
+// skeleton returns the UTS #39 skeleton of s, lowercased since domain names
+// are case insensitive. Two names with the same skeleton look alike.
+func skeleton(s string) string {
+	_, pieces := skeletonPieces(s)
+	return strings.Join(pieces, "")
+}
+
+// skeletonPieces splits the NFD form of s into characters and the part of
+// the skeleton each one maps to.
+func skeletonPieces(s string) (chars, pieces []string) {
+	for _, r := range norm.NFD.String(s) {
+		piece := string(r)
+		if prototype, ok := confusables[r]; ok {
+			piece = prototype
+		}
+		chars = append(chars, string(r))
+		pieces = append(pieces, strings.ToLower(norm.NFD.String(piece)))
+	}
+	return chars, pieces
+}
+
+// Substitution is a character of a lookalike name standing in for another.
+type Substitution struct {
+	Char      string `json:"char"`
+	CodePoint string `json:"code_point"` // U+0440, space separated for several
+	Prototype string `json:"prototype"`  // what it passes for
+}
+
+// ConfusableMatch is a brand a domain can't be told apart from visually.
+type ConfusableMatch struct {
+	Brand         string         `json:"brand"`
+	Skeleton      string         `json:"skeleton"`
+	Substitutions []Substitution `json:"substitutions"`
+}
+
+// matchConfusable compares the skeleton of d's label, in its Unicode form
+// for IDNs, with those of the brands.
+func matchConfusable(d *Domain, brands []Brand) *ConfusableMatch {
+	label := nameLabel(d)
+	if d.Unicode != "" {
+		tld := d.TLD
+		if u := toUnicode(tld); u != "" {
+			tld = u
+		}
+		label = strings.TrimSuffix(d.Unicode, "."+tld)
+	}
+	skel := skeleton(label)
+
+	for _, brand := range brands {
+		// The same name under another TLD isn't a homoglyph, matchBrand
+		// already scores those
+		if skel != brand.Skeleton || label == brand.Label {
+			continue
+		}
+		return &ConfusableMatch{
+			Brand:         brand.Domain,
+			Skeleton:      skel,
+			Substitutions: substitutions(label, brand.Label),
+		}
+	}
+	return nil
+}
+
+// substitutions lines up two names with the same skeleton and returns the
+// spans where they differ, e.g. "rn" for "m" or "р" for "p".
+func substitutions(name, brand string) []Substitution {
+	nameChars, namePieces := skeletonPieces(name)
+	brandChars, brandPieces := skeletonPieces(brand)
+
+	subs := make([]Substitution, 0)
+	var nameText, brandText strings.Builder
+	nameEnd, brandEnd := 0, 0
+	i, j := 0, 0
+	for i < len(nameChars) || j < len(brandChars) {
+		// Take characters from whichever side is behind in the skeleton
+		// until both end at the same place
+		if j >= len(brandChars) || (i < len(nameChars) && nameEnd <= brandEnd) {
+			nameText.WriteString(nameChars[i])
+			nameEnd += len(namePieces[i])
+			i++
+		} else {
+			brandText.WriteString(brandChars[j])
+			brandEnd += len(brandPieces[j])
+			j++
+		}
+		if nameEnd != brandEnd {
+			continue
+		}
+
+		if nameText.String() != brandText.String() {
+			var points []string
+			for _, r := range nameText.String() {
+				points = append(points, fmt.Sprintf("U+%04X", r))
+			}
+			subs = append(subs, Substitution{
+				Char:      nameText.String(),
+				CodePoint: strings.Join(points, " "),
+				Prototype: brandText.String(),
+			})
+		}
+		nameText.Reset()
+		brandText.Reset()
+	}
+	return subs
+}
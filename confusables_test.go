@@ -0,0 +1,102 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"paypal", "pаypal", true}, // Cyrillic а
+		{"apple", "аррle", true},   // Cyrillic а and р
+		{"google", "gооgle", true}, // Cyrillic о
+		{"modern", "rnodern", true},
+		{"microsoft", "rnicrosoft", true},
+		{"paypal", "paypa1", true},
+		{"PayPal", "paypal", true},
+		{"paypal", "paypai", false},
+		{"amazon", "arnazon", true},
+		{"amazon", "anazon", false},
+	}
+
+	for _, tt := range tests {
+		if same := skeleton(tt.a) == skeleton(tt.b); same != tt.same {
+			t.Errorf("skeleton(%q) = %q, skeleton(%q) = %q, want equal: %v", tt.a, skeleton(tt.a), tt.b, skeleton(tt.b), tt.same)
+		}
+	}
+}
+
+func TestMatchConfusable(t *testing.T) {
+	var brands []Brand
+	for _, v := range []string{"paypal.com", "apple.com", "modern.com"} {
+		brand, err := parseBrand(v)
+		if err != nil {
+			t.Fatalf("parseBrand(%q): %v", v, err)
+		}
+		brands = append(brands, brand)
+	}
+
+	tests := []struct {
+		name    string
+		brand   string // empty for no match
+		subs    []Substitution
+		scripts []string // nil for ASCII names
+		mixed   bool
+	}{
+		{
+			name:    "pаypal.com",
+			brand:   "paypal.com",
+			subs:    []Substitution{{Char: "а", CodePoint: "U+0430", Prototype: "a"}},
+			scripts: []string{"Cyrillic", "Latin"},
+			mixed:   true,
+		},
+		{
+			name:  "аррle.net",
+			brand: "apple.com",
+			subs: []Substitution{
+				{Char: "а", CodePoint: "U+0430", Prototype: "a"},
+				{Char: "р", CodePoint: "U+0440", Prototype: "p"},
+				{Char: "р", CodePoint: "U+0440", Prototype: "p"},
+			},
+			scripts: []string{"Cyrillic", "Latin"},
+			mixed:   true,
+		},
+		{
+			name:  "rnodern.com",
+			brand: "modern.com",
+			subs:  []Substitution{{Char: "rn", CodePoint: "U+0072 U+006E", Prototype: "m"}},
+		},
+		// Entirely Cyrillic, so not mixed within the label
+		{name: "рарр.com", scripts: []string{"Cyrillic", "Latin"}},
+		// The brand's own name under another TLD is left to matchBrand.
+		// Scripts are only reported for IDNs.
+		{name: "paypal.net"},
+		{name: "paypal.com"},
+		{name: "example.com"},
+	}
+
+	for _, tt := range tests {
+		d, err := parseDomain(tt.name)
+		if err != nil {
+			t.Errorf("parseDomain(%q): %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(d.Scripts, tt.scripts) || d.MixedScript != tt.mixed {
+			t.Errorf("%s: scripts %v, mixed %v, want %v, %v", tt.name, d.Scripts, d.MixedScript, tt.scripts, tt.mixed)
+		}
+
+		m := matchConfusable(&d, brands)
+		switch {
+		case tt.brand == "" && m != nil:
+			t.Errorf("%s matched %s, want no match", tt.name, m.Brand)
+		case tt.brand == "":
+		case m == nil:
+			t.Errorf("%s didn't match, want %s", tt.name, tt.brand)
+		case m.Brand != tt.brand || !slices.Equal(m.Substitutions, tt.subs):
+			t.Errorf("%s matched %s with %+v, want %s with %+v", tt.name, m.Brand, m.Substitutions, tt.brand, tt.subs)
+		}
+	}
+}
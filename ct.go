@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ctPollInterval = time.Minute
+	ctBatchSize    = 256   // entries per get-entries request, logs may return fewer
+	ctMaxPerPoll   = 50000 // so a busy log can't keep one poll going forever
+	ctBackfill     = 1000  // entries to read behind the tree head on startup
+	ctRetention    = 48 * time.Hour
+)
+
+var ctClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// ctSource polls an RFC 6962 Certificate Transparency log and reports the
+// registrable domains named in newly logged certificates. Names are kept for
+// ctRetention after the certificate was logged.
+type ctSource struct {
+	url string
+
+	mu      sync.Mutex
+	next    int64 // index of the next entry to read, -1 until the first poll
+	domains map[string]time.Time
+}
+
+func newCTSource(url string) *ctSource {
+	return &ctSource{
+		url:     strings.TrimSuffix(url, "/"),
+		next:    -1,
+		domains: make(map[string]time.Time),
+	}
+}
+
+func (c *ctSource) Name() string {
+	return "ct:" + c.url
+}
+
+func (c *ctSource) Open() (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := time.Now().Add(-ctRetention)
+	names := make([]string, 0, len(c.domains))
+	for name, ts := range c.domains {
+		if ts.Before(cutoff) {
+			delete(c.domains, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return io.NopCloser(strings.NewReader(strings.Join(names, "\n"))), nil
+}
+
+// Window returns how long names are reported after their certificate was
+// logged.
+func (c *ctSource) Window() time.Duration {
+	return ctRetention
+}
+
+// CertTimestamp returns when the first certificate naming domain was logged.
+func (c *ctSource) CertTimestamp(domain string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ts, ok := c.domains[domain]
+	return ts, ok
+}
+
+// Watch polls the log and asks for a refresh whenever new domains show up,
+// which is what makes CT discovery faster than the daily feeds.
+func (c *ctSource) Watch(notify chan<- struct{}) {
+	ticker := time.NewTicker(ctPollInterval)
+	defer ticker.Stop()
+
+	for {
+		added, err := c.poll()
+		if err != nil {
+			log.Printf("Error polling %s: %v", c.Name(), err)
+		}
+		if added > 0 {
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+
+		<-ticker.C
+	}
+}
+
+func (c *ctSource) poll() (int, error) {
+	var sth struct {
+		TreeSize int64 `json:"tree_size"`
+	}
+	if err := c.getJSON("/ct/v1/get-sth", &sth); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	next := c.next
+	c.mu.Unlock()
+
+	if next < 0 {
+		next = sth.TreeSize - ctBackfill
+		if next < 0 {
+			next = 0
+		}
+	}
+
+	added := 0
+	limit := next + ctMaxPerPoll
+	for next < sth.TreeSize && next < limit {
+		end := next + ctBatchSize - 1
+		if end >= sth.TreeSize {
+			end = sth.TreeSize - 1
+		}
+
+		var resp struct {
+			Entries []struct {
+				LeafInput string `json:"leaf_input"`
+			} `json:"entries"`
+		}
+		if err := c.getJSON(fmt.Sprintf("/ct/v1/get-entries?start=%d&end=%d", next, end), &resp); err != nil {
+			return added, err
+		}
+		if len(resp.Entries) == 0 {
+			break
+		}
+
+		c.mu.Lock()
+		for _, entry := range resp.Entries {
+			names, ts, err := parseLeaf(entry.LeafInput)
+			if err != nil {
+				continue
+			}
+			for _, name := range names {
+				domain := ctRegistrable(name)
+				if domain == "" {
+					continue
+				}
+				if prev, ok := c.domains[domain]; !ok || ts.Before(prev) {
+					if !ok {
+						added++
+					}
+					c.domains[domain] = ts
+				}
+			}
+		}
+		next += int64(len(resp.Entries))
+		c.next = next
+		c.mu.Unlock()
+	}
+
+	return added, nil
+}
+
+func (c *ctSource) getJSON(path string, v interface{}) error {
+	resp, err := ctClient.Get(c.url + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ctRegistrable reduces a certificate name to the registrable domain it
+// belongs to, or "" for names we can't use (IPs, bare suffixes).
+func ctRegistrable(name string) string {
+	name = strings.TrimPrefix(name, "*.")
+	name, err := normalizeDomain(name)
+	if err != nil || validateHostname(name) != nil {
+		return ""
+	}
+	return publicSuffixes.Registrable(name)
+}
+
+// parseLeaf decodes a base64 MerkleTreeLeaf (RFC 6962 section 3.4) and
+// returns the DNS names of the certificate or precertificate it contains,
+// along with the log timestamp.
+func parseLeaf(leafInput string) ([]string, time.Time, error) {
+	leaf, err := base64.StdEncoding.DecodeString(leafInput)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	// version(1) leaf_type(1) timestamp(8) entry_type(2)
+	if len(leaf) < 12 || leaf[0] != 0 || leaf[1] != 0 {
+		return nil, time.Time{}, fmt.Errorf("unsupported leaf")
+	}
+	ts := time.UnixMilli(int64(binary.BigEndian.Uint64(leaf[2:10])))
+	entryType := binary.BigEndian.Uint16(leaf[10:12])
+	rest := leaf[12:]
+
+	var cert *x509.Certificate
+	switch entryType {
+	case 0: // x509_entry
+		der, err := readUint24Bytes(rest)
+		if err != nil {
+			return nil, ts, err
+		}
+		cert, err = x509.ParseCertificate(der)
+		if err != nil {
+			return nil, ts, err
+		}
+	case 1: // precert_entry: issuer_key_hash[32] then the TBSCertificate
+		if len(rest) < 32 {
+			return nil, ts, fmt.Errorf("short precert entry")
+		}
+		tbs, err := readUint24Bytes(rest[32:])
+		if err != nil {
+			return nil, ts, err
+		}
+		cert, err = parseTBSCertificate(tbs)
+		if err != nil {
+			return nil, ts, err
+		}
+	default:
+		return nil, ts, fmt.Errorf("unknown entry type %d", entryType)
+	}
+
+	names := cert.DNSNames
+	if len(names) == 0 && strings.Contains(cert.Subject.CommonName, ".") {
+		names = []string{cert.Subject.CommonName}
+	}
+	return names, ts, nil
+}
+
+func readUint24Bytes(b []byte) ([]byte, error) {
+	if len(b) < 3 {
+		return nil, fmt.Errorf("short length prefix")
+	}
+	n := int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	if len(b) < 3+n {
+		return nil, fmt.Errorf("truncated entry")
+	}
+	return b[3 : 3+n], nil
+}
+
+// parseTBSCertificate wraps a precertificate's TBSCertificate in a
+// Certificate with an empty signature so crypto/x509 can parse it. The outer
+// signature algorithm has to match the inner one, so it is copied over.
+func parseTBSCertificate(tbs []byte) (*x509.Certificate, error) {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(tbs, &seq); err != nil {
+		return nil, err
+	}
+
+	// [0] version (optional), serialNumber, signature AlgorithmIdentifier
+	rest := seq.Bytes
+	var sigAlg asn1.RawValue
+	for i := 0; i < 3; i++ {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return nil, err
+		}
+		if i == 0 && field.Class == asn1.ClassContextSpecific {
+			continue
+		}
+		if field.Tag == asn1.TagSequence {
+			sigAlg = field
+			break
+		}
+	}
+	if sigAlg.FullBytes == nil {
+		return nil, fmt.Errorf("no signature algorithm in TBSCertificate")
+	}
+
+	der, err := asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		Algorithm asn1.RawValue
+		Signature asn1.BitString
+	}{
+		TBS:       asn1.RawValue{FullBytes: tbs},
+		Algorithm: asn1.RawValue{FullBytes: sigAlg.FullBytes},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server with an in-memory store reading sources.
+func newTestServer(t *testing.T, sources ...FeedSource) *Server {
+	t.Helper()
+
+	s := &Server{
+		cache:           NewCache(15 * time.Minute),
+		workers:         NewWorkerPool(runtime.NumCPU()),
+		similarityCache: make(map[string]*CachedData),
+		refresh:         make(chan struct{}, 1),
+		sourceStatus:    make(map[string]*SourceStatus),
+		lookups:         make(map[string]lookupSummary),
+		store:           newMemoryStore(),
+		sources:         sources,
+	}
+	if err := s.loadState(); err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+	return s
+}
+
+// stubLog is an RFC 6962 log serving get-sth and get-entries from a list
+// of leaves.
+type stubLog struct {
+	mu     sync.Mutex
+	leaves []string // base64 MerkleTreeLeaf
+}
+
+func (l *stubLog) add(leaf []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.leaves = append(l.leaves, base64.StdEncoding.EncodeToString(leaf))
+}
+
+func (l *stubLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/ct/v1/get-sth":
+		json.NewEncoder(w).Encode(map[string]int{"tree_size": len(l.leaves)})
+	case "/ct/v1/get-entries":
+		start, err1 := strconv.Atoi(r.URL.Query().Get("start"))
+		end, err2 := strconv.Atoi(r.URL.Query().Get("end"))
+		if err1 != nil || err2 != nil || start < 0 || start > end || end >= len(l.leaves) {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		type entry struct {
+			LeafInput string `json:"leaf_input"`
+		}
+		var resp struct {
+			Entries []entry `json:"entries"`
+		}
+		for _, leaf := range l.leaves[start : end+1] {
+			resp.Entries = append(resp.Entries, entry{LeafInput: leaf})
+		}
+		json.NewEncoder(w).Encode(resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// testCertificate returns a self-signed certificate for names.
+func testCertificate(t *testing.T, names ...string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// merkleLeaf builds a timestamped MerkleTreeLeaf holding an x509_entry, or
+// a precert_entry with the certificate's TBSCertificate.
+func merkleLeaf(ts time.Time, cert *x509.Certificate, precert bool) []byte {
+	leaf := []byte{0, 0} // v1, timestamped_entry
+	leaf = binary.BigEndian.AppendUint64(leaf, uint64(ts.UnixMilli()))
+
+	body := cert.Raw
+	if precert {
+		leaf = binary.BigEndian.AppendUint16(leaf, 1)
+		leaf = append(leaf, make([]byte, 32)...) // issuer_key_hash
+		body = cert.RawTBSCertificate
+	} else {
+		leaf = binary.BigEndian.AppendUint16(leaf, 0)
+	}
+	leaf = append(leaf, byte(len(body)>>16), byte(len(body)>>8), byte(len(body)))
+	return append(leaf, body...)
+}
+
+func TestCTSource(t *testing.T) {
+	stub := &stubLog{}
+	ts1 := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	ts2 := time.Now().Add(-30 * time.Minute).Truncate(time.Millisecond)
+	stub.add(merkleLeaf(ts1, testCertificate(t, "*.foo.com", "www.Example.co.uk"), false))
+	stub.add(merkleLeaf(ts2, testCertificate(t, "login.bank.org", "foo.com"), true))
+
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	c := newCTSource(srv.URL + "/")
+	added, err := c.poll()
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if added != 3 || c.next != 2 {
+		t.Errorf("poll added %d domains up to entry %d, want 3 up to 2", added, c.next)
+	}
+
+	want := map[string]time.Time{
+		"foo.com":       ts1, // the earliest certificate naming it
+		"example.co.uk": ts1,
+		"bank.org":      ts2,
+	}
+	for domain, ts := range want {
+		if got, ok := c.CertTimestamp(domain); !ok || !got.Equal(ts) {
+			t.Errorf("CertTimestamp(%s) = %v, %v, want %v", domain, got, ok, ts)
+		}
+	}
+	if len(c.domains) != len(want) {
+		t.Errorf("domains = %v, want %v", c.domains, want)
+	}
+
+	// Only entries past the cursor are read
+	stub.add(merkleLeaf(time.Now(), testCertificate(t, "new.example.net"), false))
+	if added, err := c.poll(); err != nil || added != 1 || c.next != 3 {
+		t.Errorf("second poll = %d, %v up to entry %d, want 1 up to 3", added, err, c.next)
+	}
+
+	s := newTestServer(t, c)
+	if err := s.fetchData(); err != nil {
+		t.Fatalf("fetchData: %v", err)
+	}
+	if len(s.domains) != 4 {
+		t.Fatalf("fetched %d domains, want 4", len(s.domains))
+	}
+	d := s.domains[s.index["bank.org"]]
+	if d.CertTimestamp == nil || !d.CertTimestamp.Equal(ts2) {
+		t.Errorf("bank.org cert timestamp = %v, want %v", d.CertTimestamp, ts2)
+	}
+
+	// Ageing out of the window isn't a removal
+	c.mu.Lock()
+	c.domains["foo.com"] = time.Now().Add(-ctRetention - time.Minute)
+	c.mu.Unlock()
+	if err := s.fetchData(); err != nil {
+		t.Fatalf("fetchData: %v", err)
+	}
+	if _, ok := s.index["foo.com"]; ok {
+		t.Errorf("foo.com is still listed after leaving the window")
+	}
+	if len(s.removed) != 0 {
+		t.Errorf("removed = %v, want none", s.removed)
+	}
+
+	// Nor is a restart that starts with an empty window
+	s.sources = []FeedSource{newCTSource(srv.URL)}
+	if err := s.fetchData(); err != nil {
+		t.Fatalf("fetchData: %v", err)
+	}
+	if len(s.domains) != 0 || len(s.removed) != 0 {
+		t.Errorf("after a cold start: %d domains, %d removed, want none", len(s.domains), len(s.removed))
+	}
+}
+
+func TestCTRegistrable(t *testing.T) {
+	tests := map[string]string{
+		"*.foo.com":           "foo.com",
+		"www.Example.co.uk":   "example.co.uk",
+		"a.b.c.example.com":   "example.com",
+		"co.uk":               "",
+		"*.co.uk":             "",
+		"10.0.0.1":            "",
+		"localhost":           "",
+		"xn--bcher-kva.de":    "xn--bcher-kva.de",
+		"shop.bücher.de":      "xn--bcher-kva.de",
+		"under_score.foo.com": "",
+	}
+	for name, want := range tests {
+		if got := ctRegistrable(name); got != want {
+			t.Errorf("ctRegistrable(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import "strings"
+
+// levenshteinWithin returns the edit distance between a and b if it is at
+// most max, and max+1 otherwise. Only a band of width 2*max+1 around the
+// diagonal is computed, so it stays cheap when scanning every domain.
+func levenshteinWithin(a, b string, max int) int {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(b)-len(a) > max {
+		return max + 1
+	}
+
+	const inf = 1 << 30
+	prev := make([]int, len(a)+1)
+	curr := make([]int, len(a)+1)
+	for i := range prev {
+		prev[i] = i
+	}
+
+	for j := 1; j <= len(b); j++ {
+		lo, hi := j-max, j+max
+		if lo < 1 {
+			lo = 1
+		}
+		if hi > len(a) {
+			hi = len(a)
+		}
+
+		curr[0] = j
+		if lo > 1 {
+			curr[lo-1] = inf
+		}
+		best := curr[0]
+		if lo > 1 {
+			best = inf
+		}
+		for i := lo; i <= hi; i++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			v := prev[i-1] + cost
+			if prev[i]+1 < v {
+				v = prev[i] + 1
+			}
+			if curr[i-1]+1 < v {
+				v = curr[i-1] + 1
+			}
+			curr[i] = v
+			if v < best {
+				best = v
+			}
+		}
+		if hi < len(a) {
+			curr[hi+1] = inf
+		}
+		if best > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+
+	if prev[len(a)] > max {
+		return max + 1
+	}
+	return prev[len(a)]
+}
+
+// damerau returns the optimal string alignment distance: Levenshtein plus
+// transposition of adjacent characters as a single edit.
+func damerau(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b, from 0 to 1.
+func jaroWinkler(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	window := max(len(a), len(b))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	matchedA := make([]bool, len(a))
+	matchedB := make([]bool, len(b))
+	matches := 0
+	for i := range a {
+		lo, hi := max(0, i-window), min(len(b), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && a[i] == b[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range a {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(a), len(b)) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// keyboardRows is a QWERTY layout, each row shifted half a key right of the
+// one above it.
+var keyboardRows = []string{"1234567890-", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// keyboardAdjacent[c] holds the keys next to c.
+var keyboardAdjacent = func() map[byte]string {
+	adjacent := make(map[byte]string)
+	at := func(row, col int) (byte, bool) {
+		if row < 0 || row >= len(keyboardRows) || col < 0 || col >= len(keyboardRows[row]) {
+			return 0, false
+		}
+		return keyboardRows[row][col], true
+	}
+
+	for r, row := range keyboardRows {
+		for c := 0; c < len(row); c++ {
+			var near []byte
+			for _, pos := range [][2]int{{r, c - 1}, {r, c + 1}, {r - 1, c}, {r - 1, c + 1}, {r + 1, c - 1}, {r + 1, c}} {
+				if k, ok := at(pos[0], pos[1]); ok {
+					near = append(near, k)
+				}
+			}
+			adjacent[row[c]] = string(near)
+		}
+	}
+	return adjacent
+}()
+
+func keysAdjacent(a, b byte) bool {
+	return strings.IndexByte(keyboardAdjacent[a], b) >= 0
+}
+
+// keyboardDistance is Levenshtein distance where substituting a key for one
+// next to it costs half an edit, since that's the typo typosquatters bet on.
+func keyboardDistance(a, b string) float64 {
+	prev := make([]float64, len(b)+1)
+	curr := make([]float64, len(b)+1)
+	for j := range prev {
+		prev[j] = float64(j)
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = float64(i)
+		for j := 1; j <= len(b); j++ {
+			cost := 1.0
+			switch {
+			case a[i-1] == b[j-1]:
+				cost = 0
+			case keysAdjacent(a[i-1], b[j-1]):
+				cost = 0.5
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,44 @@
+package main
+
+// Facets are breakdowns of every domain matching a search, not just the
+// returned page, so a dashboard can drill down without a request per count.
+type Facets struct {
+	TLDs        map[string]int `json:"tlds"`
+	Online      int            `json:"online"`
+	Offline     int            `json:"offline"`
+	StatusClass map[string]int `json:"status_class"` // 2xx..5xx, or none without a response
+	Registrars  map[string]int `json:"registrars"`   // domains with a known WHOIS registrar
+	FirstSeen   map[string]int `json:"first_seen"`   // per UTC day
+}
+
+func newFacets() *Facets {
+	return &Facets{
+		TLDs:        make(map[string]int),
+		StatusClass: make(map[string]int),
+		Registrars:  make(map[string]int),
+		FirstSeen:   make(map[string]int),
+	}
+}
+
+func (f *Facets) add(d *Domain, registrar string) {
+	f.TLDs[d.TLD]++
+
+	if d.Health.IsOnline {
+		f.Online++
+	} else {
+		f.Offline++
+	}
+
+	class := "none"
+	if code := d.Health.StatusCode; code >= 100 && code < 600 {
+		class = string(rune('0'+code/100)) + "xx"
+	}
+	f.StatusClass[class]++
+
+	if registrar != "" {
+		f.Registrars[registrar]++
+	}
+	if !d.FirstSeen.IsZero() {
+		f.FirstSeen[d.FirstSeen.UTC().Format("2006-01-02")]++
+	}
+}
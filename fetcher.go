@@ -1,9 +1,9 @@
 package main
 
 import (
-	"io"
+	"fmt"
 	"log"
-	"net/http"
+	"sort"
 	"strings"
 	"time"
 )
@@ -17,65 +17,287 @@ func (s *Server) backgroundFetch() {
 			log.Printf("Error fetching data: %v", err)
 		}
 
-		<-ticker.C
+		select {
+		case <-ticker.C:
+		case <-s.refresh:
+		}
 	}
 }
 
 func (s *Server) fetchData() error {
-	// Fetch new domains
-	newDomains, err := fetchFile("https://codeberg.org/webamon/newly_registered_domains/raw/branch/main/new_domains.txt")
-	if err != nil {
-		return err
+	type result struct {
+		src     FeedSource
+		fetched []Domain
+		reuse   bool // keep the domains the source reported last time
+	}
+
+	var (
+		results   = make([]result, 0, len(s.sources))
+		failed    []string
+		dropped   []Domain
+		undiffed  = make(map[string]bool)
+		reports   = make([]IngestReport, 0, len(s.sources))
+		unchanged = 0
+	)
+
+	for _, src := range s.sources {
+		fetched, rep, err := fetchSource(src)
+		res := result{src: src, fetched: fetched}
+
+		switch {
+		case err == errNotModified:
+			res.reuse = true
+		case err != nil:
+			log.Printf("Error fetching %s: %v", src.Name(), err)
+			failed = append(failed, src.Name())
+
+			// Keep what the source reported last time rather than
+			// dropping its domains because of a transient error
+			res.reuse = true
+			rep.StaleReuse = true
+		default:
+			rep.Unchanged = s.contentUnchanged(rep)
+		}
+		if rep.Unchanged {
+			unchanged++
+		}
+		s.recordSourceStatus(rep)
+
+		if _, ok := src.(windowSource); ok {
+			undiffed[src.Name()] = true
+		}
+		if dr, ok := src.(dropReporter); ok {
+			// Its domains are only removed when it says they were
+			undiffed[src.Name()] = true
+			for _, name := range dr.Dropped() {
+				if d, err := parseDomain(name); err == nil {
+					d.Sources = []string{src.Name()}
+					dropped = append(dropped, d)
+				}
+			}
+		}
+
+		reports = append(reports, rep)
+		results = append(results, res)
 	}
 
+	now := time.Now()
+	s.statusMu.Lock()
+	s.ingestion = reports
+	s.lastCheck = now
+	s.statusMu.Unlock()
+
+	if len(failed) == len(s.sources) {
+		return fmt.Errorf("all feed sources failed: %s", strings.Join(failed, ", "))
+	}
+
+	// Nothing upstream changed, so the current snapshot, stats and health
+	// data stay as they are
+	if unchanged+len(failed) == len(s.sources) && len(dropped) == 0 {
+		log.Printf("Feeds unchanged, keeping %d domains", s.domainCount())
+		return nil
+	}
+
+	var (
+		domains []Domain
+		index   = make(map[string]int)
+	)
+
+	add := func(d Domain, source string) {
+		if i, ok := index[d.Name]; ok {
+			if srcs := domains[i].Sources; srcs[len(srcs)-1] != source {
+				domains[i].Sources = append(srcs, source)
+			}
+			if domains[i].CertTimestamp == nil {
+				domains[i].CertTimestamp = d.CertTimestamp
+			}
+			return
+		}
+		d.Sources = []string{source}
+		index[d.Name] = len(domains)
+		domains = append(domains, d)
+	}
+
+	for _, res := range results {
+		fetched := res.fetched
+		if res.reuse {
+			fetched = s.sourceDomains(res.src.Name())
+		}
+		for _, d := range fetched {
+			add(d, res.src.Name())
+		}
+	}
+
+	// Built before taking the lock, they only depend on the new list
+	s.scoreNewDomains(domains)
+	search := newSearchIndex(domains)
+
 	// Update server state
 	s.mu.Lock()
-	s.domains = parseDomains(newDomains)
-	s.lastUpdate = time.Now()
+	s.lastUpdate = now
+	added, removed := s.applyDomains(domains, dropped, undiffed, s.lastUpdate)
+	s.search = search
+	s.version++
 	s.updateStats()
+	s.stats.LastAdded = len(added)
+	s.stats.LastRemoved = removed
 	s.mu.Unlock()
 
-	return nil
-}
+	log.Printf("Fetched %d domains (%d added, %d removed)", len(domains), len(added), removed)
 
-func fetchFile(url string) (string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
+	s.evaluateWatchlists(added, now)
+
+	if err := s.store.SaveState(s.storedState()); err != nil {
+		log.Printf("Error saving state: %v", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	return nil
+}
+
+// onlyFrom reports whether every one of sources is in names.
+func onlyFrom(sources []string, names map[string]bool) bool {
+	for _, src := range sources {
+		if !names[src] {
+			return false
+		}
 	}
+	return len(sources) > 0
+}
 
-	return string(body), nil
+func (s *Server) domainCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.domains)
 }
 
-func parseDomains(data string) []Domain {
-	lines := strings.Split(data, "\n")
-	domains := make([]Domain, 0, len(lines))
+// removedRetention is how long dropped domains are kept for /domains/removed.
+const removedRetention = 7 * 24 * time.Hour
+
+// applyDomains replaces the current snapshot with domains, carrying over
+// what we already know about domains that are still present and recording
+// the ones that dropped out of the feed, along with any drops reported
+// directly by a source. Domains that only came from undiffed sources aren't
+// recorded as removed when they drop out. It returns copies of the domains
+// that weren't in the snapshot before. Callers must hold s.mu.
+func (s *Server) applyDomains(domains, dropped []Domain, undiffed map[string]bool, now time.Time) (added []Domain, removed int) {
+	index := make(map[string]int, len(domains))
+	var fresh []int
+	for i := range domains {
+		d := &domains[i]
+		index[d.Name] = i
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+		if j, ok := s.index[d.Name]; ok {
+			d.Health = s.domains[j].Health
 			continue
 		}
+		fresh = append(fresh, i)
+	}
+	s.markSeen(domains, now)
+
+	// Copied once markSeen has set their first seen times
+	added = make([]Domain, 0, len(fresh))
+	for _, i := range fresh {
+		added = append(added, domains[i])
+	}
 
-		parts := strings.Split(line, ".")
-		if len(parts) < 2 {
+	gone := make(map[string]bool)
+	for _, prev := range s.domains {
+		if _, ok := index[prev.Name]; ok || onlyFrom(prev.Sources, undiffed) {
 			continue
 		}
+		s.removed = append(s.removed, RemovedDomain{Domain: prev, RemovedAt: now})
+		gone[prev.Name] = true
+		removed++
+	}
+
+	for _, d := range dropped {
+		if _, ok := index[d.Name]; ok || gone[d.Name] {
+			continue
+		}
+		if rec, ok := s.seen[d.Name]; ok {
+			d.FirstSeen, d.LastSeen, d.CreatedAt = rec.FirstSeen, rec.LastSeen, rec.FirstSeen
+		}
+		s.removed = append(s.removed, RemovedDomain{Domain: d, RemovedAt: now})
+		gone[d.Name] = true
+		removed++
+	}
+
+	// s.removed is in removal order, so expired entries are at the front
+	cutoff := now.Add(-removedRetention)
+	i := sort.Search(len(s.removed), func(i int) bool {
+		return s.removed[i].RemovedAt.After(cutoff)
+	})
+	s.removed = s.removed[i:]
+
+	s.domains = domains
+	s.index = index
 
-		tld := parts[len(parts)-1]
-		domains = append(domains, Domain{
-			Name:      line,
-			TLD:       tld,
-			CreatedAt: time.Now(),
-			Health:    DomainHealth{}, // Will be updated by health checker
+	return added, removed
+}
+
+const (
+	fetchAttempts = 4
+	fetchBackoff  = 5 * time.Second
+)
+
+// fetchSource reads a source, retrying with exponential backoff. Domains are
+// staged per source so a failure halfway through doesn't leave a partial list
+// behind.
+func fetchSource(src FeedSource) ([]Domain, IngestReport, error) {
+	var (
+		fetched []Domain
+		rep     IngestReport
+		err     error
+		backoff = fetchBackoff
+	)
+
+	ct, _ := src.(certTimestamper)
+
+	for attempt := 1; attempt <= fetchAttempts; attempt++ {
+		fetched = nil
+		rep = IngestReport{Source: src.Name(), StartedAt: time.Now(), Attempts: attempt}
+		err = readSource(src, &rep, func(d Domain) {
+			if ct != nil {
+				if ts, ok := ct.CertTimestamp(d.Name); ok {
+					d.CertTimestamp = &ts
+				}
+			}
+			fetched = append(fetched, d)
 		})
+		rep.Duration = time.Since(rep.StartedAt)
+
+		if err == nil || err == errNotModified || !retryable(err) || attempt == fetchAttempts {
+			break
+		}
+
+		log.Printf("Error fetching %s (attempt %d/%d), retrying in %v: %v", src.Name(), attempt, fetchAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	// A 304 is a successful fetch of content we already have
+	if err == errNotModified {
+		rep.Unchanged = true
+	} else if err != nil {
+		rep.Error = err.Error()
 	}
+	return fetched, rep, err
+}
 
+// sourceDomains returns the domains currently attributed to a source.
+func (s *Server) sourceDomains(source string) []Domain {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var domains []Domain
+	for _, d := range s.domains {
+		for _, src := range d.Sources {
+			if src == source {
+				d.Sources = nil
+				domains = append(domains, d)
+				break
+			}
+		}
+	}
 	return domains
 }
@@ -6,11 +6,13 @@ require (
 	github.com/go-chi/chi/v5 v5.2.0
 	github.com/likexian/whois v1.15.1
 	github.com/likexian/whois-parser v1.24.9
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0
 	golang.org/x/time v0.5.0
 )
 
 require (
 	github.com/likexian/gokit v0.25.13 // indirect
-	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/text v0.13.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
@@ -4,47 +4,54 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 )
 
 func (s *Server) handleDomains(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
-	page, _ := strconv.Atoi(query.Get("page"))
-	limit, _ := strconv.Atoi(query.Get("limit"))
-	search := query.Get("search")
+	mixedOnly := query.Get("mixed_script") == "true"
 
-	if page < 1 {
-		page = 1
+	minRisk := 0
+	if v := query.Get("min_risk"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 100 {
+			http.Error(w, "min_risk must be a score between 0 and 100", http.StatusBadRequest)
+			return
+		}
+		minRisk = n
 	}
-	if limit < 1 || limit > 100 {
-		limit = 50
+
+	search, err := parseSearch(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	s.mu.RLock()
-	filtered := make([]Domain, 0)
-	for _, domain := range s.domains {
-		if search != "" && !strings.Contains(domain.Name, search) {
-			continue
-		}
-		filtered = append(filtered, domain)
+	q, err := ParseQuery(query.Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	s.mu.RUnlock()
 
-	start := (page - 1) * limit
-	end := start + limit
-	if end > len(filtered) {
-		end = len(filtered)
+	opts, err := parseListOptions(r, "name", false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if search.expensive {
+		opts.deadline = time.Now().Add(searchTimeout)
+		opts.maxMatches = maxSearchMatches
 	}
 
-	response := map[string]interface{}{
-		"domains": filtered[start:end],
-		"total":   len(filtered),
-		"page":    page,
-		"limit":   limit,
+	terms := append(q.required, search.terms...)
+	res := s.searchDomains(terms, func(d *Domain) bool {
+		return (!mixedOnly || d.MixedScript) && riskScore(d) >= minRisk && search.match(d) && q.Match(d)
+	}, opts)
+	if opts.after == nil {
+		res.Page = opts.offset/opts.limit + 1
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeDomainList(w, res)
 }
 
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
@@ -52,6 +59,10 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	stats := s.stats
 	s.mu.RUnlock()
 
+	s.statusMu.Lock()
+	stats.LastCheckTime = s.lastCheck
+	s.statusMu.Unlock()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// handleConfusables lists domains that are visually identical to a brand,
+// optionally only those of ?brand=.
+func (s *Server) handleConfusables(w http.ResponseWriter, r *http.Request) {
+	brand := strings.ToLower(r.URL.Query().Get("brand"))
+
+	opts, err := parseListOptions(r, "first_seen", true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := s.searchDomains(nil, func(d *Domain) bool {
+		return d.Confusable != nil && (brand == "" || d.Confusable.Brand == brand)
+	}, opts)
+
+	writeDomainList(w, res)
+}
+
+// handleCombosquats lists domains combining a brand name with lure words,
+// optionally only those of ?brand= or with the lure ?lure=.
+func (s *Server) handleCombosquats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	brand := strings.ToLower(query.Get("brand"))
+	lure := strings.ToLower(query.Get("lure"))
+
+	opts, err := parseListOptions(r, "first_seen", true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := s.searchDomains(nil, func(d *Domain) bool {
+		if d.Combo == nil || (brand != "" && d.Combo.Brand != brand) {
+			return false
+		}
+		return lure == "" || slices.Contains(d.Combo.Lures, lure)
+	}, opts)
+
+	writeDomainList(w, res)
+}
+
+// handlePermutations generates typosquatting candidates for ?domain= and
+// reports which of them are in the feed. Pass registered=true for only those.
+func (s *Server) handlePermutations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	domain, err := normalizeDomain(query.Get("domain"))
+	if err == nil {
+		err = validateHostname(domain)
+	}
+	if err != nil {
+		http.Error(w, "domain parameter must be a valid domain", http.StatusBadRequest)
+		return
+	}
+	registeredOnly := query.Get("registered") == "true"
+
+	perms := permutations(domain, s.feedTLDs())
+	s.markRegistered(perms)
+
+	registered := 0
+	list := make([]Permutation, 0, len(perms))
+	for _, p := range perms {
+		if p.Registered {
+			registered++
+		} else if registeredOnly {
+			continue
+		}
+		list = append(list, p)
+	}
+	// Registered ones first, otherwise in the order they were generated
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Registered && !list[j].Registered
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domain":       domain,
+		"total":        len(perms),
+		"registered":   registered,
+		"permutations": list,
+	})
+}
@@ -2,28 +2,147 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
 func (s *Server) handleNewDomains(w http.ResponseWriter, r *http.Request) {
-	cutoff := time.Now().Add(-24 * time.Hour)
+	since, until, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseListOptions(r, "first_seen", true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := s.searchDomains(nil, func(d *Domain) bool {
+		return inRange(d.FirstSeen, since, until)
+	}, opts)
+
+	writeDomainList(w, res)
+}
+
+func (s *Server) handleRemovedDomains(w http.ResponseWriter, r *http.Request) {
+	since, until, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	s.mu.RLock()
-	newDomains := make([]Domain, 0)
-	for _, domain := range s.domains {
-		if domain.CreatedAt.After(cutoff) {
-			newDomains = append(newDomains, domain)
+	removed := make([]RemovedDomain, 0)
+	for _, domain := range s.removed {
+		if inRange(domain.RemovedAt, since, until) {
+			removed = append(removed, domain)
 		}
 	}
 	s.mu.RUnlock()
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(newDomains)
+	json.NewEncoder(w).Encode(removed)
 }
 
-func (s *Server) handleRemovedDomains(w http.ResponseWriter, r *http.Request) {
-	// This would require tracking removed domains in the Server struct
+func (s *Server) handleHealthHistory(w http.ResponseWriter, r *http.Request) {
+	name, err := normalizeDomain(chi.URLParam(r, "name"))
+	if err != nil {
+		http.Error(w, "invalid domain", http.StatusBadRequest)
+		return
+	}
+
+	since, until, err := parseTimeRange(r, historyRetention)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.store.HealthHistory(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history := HealthHistory{Domain: name, Checks: make([]HealthRecord, 0)}
+	for i, rec := range records {
+		// First online looks at everything we have, not just the range
+		if rec.IsOnline && history.FirstOnline == nil {
+			history.FirstOnline = &records[i].CheckedAt
+		}
+		if !inRange(rec.CheckedAt, since, until) {
+			continue
+		}
+
+		if n := len(history.Checks); n > 0 && history.Checks[n-1].IsOnline != rec.IsOnline {
+			history.Transitions++
+		}
+		if rec.IsOnline {
+			history.Online++
+			history.LastOnline = &records[i].CheckedAt
+		}
+		history.Checks = append(history.Checks, rec)
+	}
+
+	history.Total = len(history.Checks)
+	if history.Total > 0 {
+		history.UptimePercent = float64(history.Online) * 100 / float64(history.Total)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode([]Domain{})
+	json.NewEncoder(w).Encode(history)
+}
+
+// parseTimeRange reads the since/until query parameters. Both accept RFC 3339
+// timestamps or Unix seconds. until defaults to now and since to window
+// before until, where window can be overridden with e.g. ?window=72h.
+func parseTimeRange(r *http.Request, window time.Duration) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	until := time.Now()
+
+	if v := query.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return time.Time{}, until, fmt.Errorf("invalid window: %q", v)
+		}
+		window = d
+	}
+
+	if v := query.Get("until"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return time.Time{}, until, fmt.Errorf("invalid until: %v", err)
+		}
+		until = t
+	}
+
+	since := until.Add(-window)
+	if v := query.Get("since"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return since, until, fmt.Errorf("invalid since: %v", err)
+		}
+		since = t
+	}
+	if until.Before(since) {
+		return since, until, fmt.Errorf("until is before since")
+	}
+
+	return since, until, nil
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func inRange(t, since, until time.Time) bool {
+	return !t.Before(since) && !t.After(until)
 }
@@ -3,6 +3,10 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
 )
 
 func (s *Server) handleTLDs(w http.ResponseWriter, r *http.Request) {
@@ -17,25 +21,25 @@ func (s *Server) handleTLDs(w http.ResponseWriter, r *http.Request) {
 	for tld := range tlds {
 		tldList = append(tldList, tld)
 	}
+	sort.Strings(tldList)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tldList)
 }
 
 func (s *Server) handleTLDDomains(w http.ResponseWriter, r *http.Request) {
-	// Extract TLD from path
-	path := r.URL.Path
-	tld := path[len("/api/v1/tlds/"):]
+	// Effective TLDs such as co.uk are matched as a whole
+	tld := strings.ToLower(strings.TrimPrefix(chi.URLParam(r, "tld"), "."))
 
-	s.mu.RLock()
-	domains := make([]Domain, 0)
-	for _, domain := range s.domains {
-		if domain.TLD == tld {
-			domains = append(domains, domain)
-		}
+	opts, err := parseListOptions(r, "name", false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	s.mu.RUnlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(domains)
+	res := s.searchDomains(nil, func(d *Domain) bool {
+		return d.TLD == tld
+	}, opts)
+
+	writeDomainList(w, res)
 }
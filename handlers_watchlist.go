@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxWatchMatches is the most matches /watchlists/{id}/matches returns.
+const maxWatchMatches = 1000
+
+func (s *Server) handleWatchlists(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.listWatchlists())
+}
+
+func (s *Server) handleWatchlist(w http.ResponseWriter, r *http.Request) {
+	wl, ok := s.getWatchlist(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, "watchlist not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wl)
+}
+
+func (s *Server) handleCreateWatchlist(w http.ResponseWriter, r *http.Request) {
+	c, err := decodeWatchlist(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.ID = newWatchlistID()
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+
+	if err := s.saveWatchlist(c); err != nil {
+		log.Printf("Error saving watchlist: %v", err)
+		http.Error(w, "Failed to save watchlist", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c.Watchlist)
+}
+
+func (s *Server) handleUpdateWatchlist(w http.ResponseWriter, r *http.Request) {
+	prev, ok := s.getWatchlist(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, "watchlist not found", http.StatusNotFound)
+		return
+	}
+
+	c, err := decodeWatchlist(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.ID = prev.ID
+	c.CreatedAt = prev.CreatedAt
+	c.UpdatedAt = time.Now()
+
+	if err := s.saveWatchlist(c); err != nil {
+		log.Printf("Error saving watchlist: %v", err)
+		http.Error(w, "Failed to save watchlist", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Watchlist)
+}
+
+func (s *Server) handleDeleteWatchlist(w http.ResponseWriter, r *http.Request) {
+	found, err := s.deleteWatchlist(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Printf("Error deleting watchlist: %v", err)
+		http.Error(w, "Failed to delete watchlist", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "watchlist not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeWatchlist reads a watchlist from the request body. The id and
+// timestamps are the server's to set, so they are ignored.
+func decodeWatchlist(w http.ResponseWriter, r *http.Request) (*compiledWatchlist, error) {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	var wl Watchlist
+	if err := dec.Decode(&wl); err != nil {
+		return nil, fmt.Errorf("invalid watchlist: %v", err)
+	}
+	return wl.compile()
+}
+
+// handleWatchMatches lists the domains that matched a watchlist within the
+// since/until range, newest first. limit caps how many are returned.
+func (s *Server) handleWatchMatches(w http.ResponseWriter, r *http.Request) {
+	wl, ok := s.getWatchlist(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, "watchlist not found", http.StatusNotFound)
+		return
+	}
+
+	since, until, err := parseTimeRange(r, watchMatchRetention)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxWatchMatches {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxWatchMatches), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	matches, err := s.store.WatchMatches(wl.ID, since, until)
+	if err != nil {
+		log.Printf("Error reading watchlist matches: %v", err)
+		http.Error(w, "Failed to read matches", http.StatusInternalServerError)
+		return
+	}
+
+	total := len(matches)
+	list := make([]WatchMatch, 0, min(limit, total))
+	for i := total - 1; i >= 0 && len(list) < limit; i-- {
+		list = append(list, matches[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"watchlist": wl,
+		"since":     since,
+		"until":     until,
+		"total":     total,
+		"matches":   list,
+	})
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"runtime"
 	"time"
 )
 
+// historyRetention is how long individual health check results are kept.
+const historyRetention = 30 * 24 * time.Hour
+
 var healthClient = &http.Client{
 	Timeout: 5 * time.Second,
 	Transport: &http.Transport{
@@ -92,11 +96,20 @@ func (s *Server) updateDomainsHealth() {
 		s.mu.Lock()
 		for i, domain := range s.domains {
 			if health, ok := healthMap[domain.Name]; ok {
+				prev := s.domains[i].Health
 				s.domains[i].Health = health
+				// Only the online state and status count towards risk
+				if prev.IsOnline != health.IsOnline || prev.StatusCode != health.StatusCode {
+					s.rescoreRisk(domain.Name)
+				}
 			}
 		}
 		s.mu.Unlock()
 
+		if err := s.store.RecordHealth(time.Now(), healthMap); err != nil {
+			log.Printf("Error saving health: %v", err)
+		}
+
 		<-ticker.C
 	}
 }
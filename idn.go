@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// scripts are the writing systems we tell apart when looking for mixed-script
+// labels. Common (digits, hyphen) and Inherited (combining marks) characters
+// belong to every script and are ignored.
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Georgian", unicode.Georgian},
+	{"Hebrew", unicode.Hebrew},
+	{"Arabic", unicode.Arabic},
+	{"Devanagari", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+	{"Cherokee", unicode.Cherokee},
+}
+
+// normalizeDomain lowercases a feed entry and converts Unicode names to their
+// ASCII (punycode) form so every domain is stored and compared the same way.
+func normalizeDomain(name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			return idna.ToASCII(name)
+		}
+	}
+	return name, nil
+}
+
+// toUnicode decodes the punycode labels of an ASCII domain. It returns an
+// empty string when the domain has no IDN labels or cannot be decoded.
+func toUnicode(name string) string {
+	if !strings.Contains(name, "xn--") {
+		return ""
+	}
+
+	unicodeName, err := idna.ToUnicode(name)
+	if err != nil || unicodeName == name {
+		return ""
+	}
+	return unicodeName
+}
+
+// labelScripts returns the scripts used by each label of a Unicode domain name
+// and whether any single label mixes more than one of them. Mixing across
+// labels (a Cyrillic name under .com) is normal; mixing inside a label is the
+// homograph pattern.
+func labelScripts(name string) ([]string, bool) {
+	all := make(map[string]bool)
+	mixed := false
+
+	for _, label := range strings.Split(name, ".") {
+		inLabel := make(map[string]bool)
+		for _, r := range label {
+			if r < unicode.MaxASCII && !unicode.IsLetter(r) {
+				continue
+			}
+			for _, sc := range scripts {
+				if unicode.Is(sc.table, r) {
+					inLabel[sc.name] = true
+					break
+				}
+			}
+		}
+
+		if !japaneseMix(inLabel) && len(inLabel) > 1 {
+			mixed = true
+		}
+		for sc := range inLabel {
+			all[sc] = true
+		}
+	}
+
+	names := make([]string, 0, len(all))
+	for sc := range all {
+		names = append(names, sc)
+	}
+	sort.Strings(names)
+
+	return names, mixed
+}
+
+// japaneseMix reports whether the scripts are a legitimate Japanese mix of
+// Han, Hiragana and Katakana (optionally with Latin, as is common).
+func japaneseMix(inLabel map[string]bool) bool {
+	if !inLabel["Hiragana"] && !inLabel["Katakana"] {
+		return false
+	}
+	for sc := range inLabel {
+		switch sc {
+		case "Han", "Hiragana", "Katakana", "Latin":
+		default:
+			return false
+		}
+	}
+	return true
+}
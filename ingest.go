@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	maxLineLength     = 1024 // longer lines are rejected without being buffered
+	maxRejectedSample = 20
+)
+
+// IngestReport describes how one fetch of one source went.
+type IngestReport struct {
+	Source     string         `json:"source"`
+	StartedAt  time.Time      `json:"started_at"`
+	Duration   time.Duration  `json:"duration"`
+	Attempts   int            `json:"attempts"`
+	Bytes      int64          `json:"bytes"`
+	Lines      int            `json:"lines"`
+	Accepted   int            `json:"accepted"`
+	Rejected   int            `json:"rejected"`
+	Skipped    int            `json:"skipped"` // blank lines and comments
+	Samples    []RejectedLine `json:"rejected_samples,omitempty"`
+	Hash       string         `json:"hash,omitempty"` // SHA-256 of the raw feed
+	Unchanged  bool           `json:"unchanged,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	StaleReuse bool           `json:"stale_reuse,omitempty"` // previous domains kept after an error
+}
+
+// RejectedLine is a feed line that did not parse as a hostname.
+type RejectedLine struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+func (rep *IngestReport) reject(line int, text, reason string) {
+	rep.Rejected++
+	if len(rep.Samples) >= maxRejectedSample {
+		return
+	}
+	if len(text) > 100 {
+		text = text[:100] + "..."
+	}
+	rep.Samples = append(rep.Samples, RejectedLine{Line: line, Text: text, Reason: reason})
+}
+
+// readSource streams a source line by line, calling emit for every valid
+// domain. Only one line is held in memory at a time.
+func readSource(src FeedSource, rep *IngestReport, emit func(Domain)) error {
+	rc, err := src.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	reader := bufio.NewReaderSize(&countingReader{r: io.TeeReader(rc, hash), n: &rep.Bytes}, maxLineLength)
+	for lineNo := 1; ; lineNo++ {
+		raw, isPrefix, err := reader.ReadLine()
+		if err == io.EOF {
+			rep.Hash = hex.EncodeToString(hash.Sum(nil))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rep.Lines++
+
+		if isPrefix {
+			// Copied first, draining the rest of the line overwrites raw.
+			// One byte over what reject keeps so it still marks the cut.
+			sample := string(raw[:min(len(raw), 101)])
+			for isPrefix && err == nil {
+				_, isPrefix, err = reader.ReadLine()
+			}
+			rep.reject(lineNo, sample, "line too long")
+			if err != nil && err != io.EOF {
+				return err
+			}
+			continue
+		}
+
+		line := strings.TrimSpace(string(raw))
+		if line == "" || strings.HasPrefix(line, "#") {
+			rep.Skipped++
+			continue
+		}
+
+		domain, err := parseDomain(line)
+		if err != nil {
+			rep.reject(lineNo, line, err.Error())
+			continue
+		}
+		rep.Accepted++
+		emit(domain)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// parseDomain validates a single feed entry and fills in everything derived
+// from the name itself.
+func parseDomain(line string) (Domain, error) {
+	name, err := normalizeDomain(line)
+	if err != nil {
+		return Domain{}, fmt.Errorf("invalid IDN: %v", err)
+	}
+	if err := validateHostname(name); err != nil {
+		return Domain{}, err
+	}
+
+	domain := Domain{
+		Name:        name,
+		TLD:         publicSuffixes.PublicSuffix(name),
+		Registrable: publicSuffixes.Registrable(name),
+		Health:      DomainHealth{}, // Will be updated by health checker
+	}
+	if u := toUnicode(name); u != "" {
+		domain.Unicode = u
+		domain.Scripts, domain.MixedScript = labelScripts(u)
+	}
+	return domain, nil
+}
+
+// validateHostname checks an ASCII domain against the RFC 1035 / 1123
+// hostname rules.
+func validateHostname(name string) error {
+	if len(name) > 253 {
+		return fmt.Errorf("name longer than 253 characters")
+	}
+
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("no TLD")
+	}
+
+	for _, label := range labels {
+		if label == "" {
+			return fmt.Errorf("empty label")
+		}
+		if len(label) > 63 {
+			return fmt.Errorf("label longer than 63 characters")
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label starts or ends with a hyphen")
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid character %q", c)
+			}
+		}
+	}
+
+	tld := labels[len(labels)-1]
+	if strings.Trim(tld, "0123456789") == "" {
+		return fmt.Errorf("numeric TLD")
+	}
+	return nil
+}
+
+func (s *Server) handleIngestion(w http.ResponseWriter, r *http.Request) {
+	s.statusMu.Lock()
+	reports := s.ingestion
+	s.statusMu.Unlock()
+
+	if reports == nil {
+		reports = []IngestReport{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// SourceStatus summarises the health of a feed source across fetches.
+type SourceStatus struct {
+	Name                string        `json:"name"`
+	Healthy             bool          `json:"healthy"`
+	LastAttempt         time.Time     `json:"last_attempt"`
+	LastSuccess         time.Time     `json:"last_success,omitempty"`
+	LastError           string        `json:"last_error,omitempty"`
+	LastErrorAt         time.Time     `json:"last_error_at,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	Bytes               int64         `json:"bytes"`
+	Domains             int           `json:"domains"`
+	Duration            time.Duration `json:"duration"`
+	ContentHash         string        `json:"content_hash,omitempty"`
+	UnchangedSince      time.Time     `json:"unchanged_since,omitempty"`
+}
+
+// contentUnchanged reports whether a successful fetch returned exactly what
+// the previous one did.
+func (s *Server) contentUnchanged(rep IngestReport) bool {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	st, ok := s.sourceStatus[rep.Source]
+	return ok && st.ContentHash != "" && st.ContentHash == rep.Hash
+}
+
+func (s *Server) recordSourceStatus(rep IngestReport) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	st, ok := s.sourceStatus[rep.Source]
+	if !ok {
+		st = &SourceStatus{Name: rep.Source}
+		s.sourceStatus[rep.Source] = st
+	}
+
+	st.LastAttempt = rep.StartedAt
+	st.Duration = rep.Duration
+	if rep.Error != "" {
+		st.Healthy = false
+		st.LastError = rep.Error
+		st.LastErrorAt = rep.StartedAt
+		st.ConsecutiveFailures++
+		return
+	}
+
+	st.Healthy = true
+	st.LastSuccess = rep.StartedAt
+	st.ConsecutiveFailures = 0
+	if rep.Unchanged {
+		return
+	}
+	st.Bytes = rep.Bytes
+	st.Domains = rep.Accepted
+	st.ContentHash = rep.Hash
+	st.UnchangedSince = rep.StartedAt
+}
+
+func (s *Server) handleSources(w http.ResponseWriter, r *http.Request) {
+	s.statusMu.Lock()
+	statuses := make([]SourceStatus, 0, len(s.sources))
+	for _, src := range s.sources {
+		if st, ok := s.sourceStatus[src.Name()]; ok {
+			statuses = append(statuses, *st)
+		} else {
+			statuses = append(statuses, SourceStatus{Name: src.Name()})
+		}
+	}
+	s.statusMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"strings"
@@ -42,14 +43,27 @@ func (s *Server) handleWhoisLookup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check cache first
-	if cached, ok := s.cache.Get(fmt.Sprintf("whois:%s", domain)); ok {
+	// Check cache first, then the store
+	key := fmt.Sprintf("whois:%s", domain)
+	if cached, ok := s.cache.Get(key); ok {
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("X-Cache", "HIT")
 		json.NewEncoder(w).Encode(cached)
 		return
 	}
 
+	stored := &WhoisInfo{}
+	if ok, err := s.store.GetLookup(key, stored); err != nil {
+		log.Printf("Error reading stored WHOIS for %s: %v", domain, err)
+	} else if ok {
+		s.cache.Set(key, stored)
+		s.noteWhois(stored)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", "HIT")
+		json.NewEncoder(w).Encode(stored)
+		return
+	}
+
 	whoisInfo := &WhoisInfo{
 		DomainName: domain,
 	}
@@ -124,7 +138,11 @@ func (s *Server) handleWhoisLookup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cache the result
-	s.cache.Set(fmt.Sprintf("whois:%s", domain), whoisInfo)
+	s.cache.Set(key, whoisInfo)
+	s.noteWhois(whoisInfo)
+	if err := s.store.PutLookup(key, whoisInfo); err != nil {
+		log.Printf("Error storing WHOIS for %s: %v", domain, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Cache", "MISS")
@@ -138,14 +156,27 @@ func (s *Server) handleReverseDNS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check cache first
-	if cached, ok := s.cache.Get(fmt.Sprintf("dns:%s", domain)); ok {
+	// Check cache first, then the store
+	key := fmt.Sprintf("dns:%s", domain)
+	if cached, ok := s.cache.Get(key); ok {
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("X-Cache", "HIT")
 		json.NewEncoder(w).Encode(cached)
 		return
 	}
 
+	stored := &DNSInfo{}
+	if ok, err := s.store.GetLookup(key, stored); err != nil {
+		log.Printf("Error reading stored DNS for %s: %v", domain, err)
+	} else if ok {
+		s.cache.Set(key, stored)
+		s.noteDNS(stored)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", "HIT")
+		json.NewEncoder(w).Encode(stored)
+		return
+	}
+
 	dnsInfo := &DNSInfo{
 		Domain: domain,
 	}
@@ -219,7 +250,11 @@ func (s *Server) handleReverseDNS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cache the result
-	s.cache.Set(fmt.Sprintf("dns:%s", domain), dnsInfo)
+	s.cache.Set(key, dnsInfo)
+	s.noteDNS(dnsInfo)
+	if err := s.store.PutLookup(key, dnsInfo); err != nil {
+		log.Printf("Error storing DNS for %s: %v", domain, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Cache", "MISS")
@@ -253,3 +288,110 @@ func (s *Server) performWhoisLookup(domain string) WhoisInfo {
 func (s *Server) performDNSLookup(domain string) DNSInfo {
 	return DNSInfo{Domain: domain} // Implement full DNS lookup logic as needed
 }
+
+// lookupSummary is what WHOIS and DNS lookups found about a domain, for
+// facets and risk scoring.
+type lookupSummary struct {
+	Registrar   string
+	Private     bool     // registrant behind a privacy service
+	NameServers []string // from DNS if looked up, otherwise WHOIS
+}
+
+// privacyMarkers are found in registrant details hidden by a privacy or
+// proxy service, or redacted by the registry.
+var privacyMarkers = []string{"privacy", "redacted", "proxy", "whoisguard", "withheld", "protected", "not disclosed"}
+
+func (l *lookupSummary) addWhois(info *WhoisInfo) {
+	l.Registrar = info.Registrar
+
+	reg := info.Registrant
+	contact := strings.ToLower(reg.Name + " " + reg.Organization + " " + reg.Email)
+	l.Private = false
+	for _, marker := range privacyMarkers {
+		if strings.Contains(contact, marker) {
+			l.Private = true
+			break
+		}
+	}
+
+	if len(l.NameServers) == 0 {
+		for _, ns := range info.NameServers {
+			l.NameServers = append(l.NameServers, strings.ToLower(strings.TrimSuffix(ns, ".")))
+		}
+	}
+}
+
+func (l *lookupSummary) addDNS(info *DNSInfo) {
+	if len(info.NSRecords) == 0 {
+		return
+	}
+	l.NameServers = nil
+	for _, ns := range info.NSRecords {
+		l.NameServers = append(l.NameServers, strings.ToLower(ns.Host))
+	}
+}
+
+// noteWhois remembers a WHOIS result and rescores the domain's risk.
+func (s *Server) noteWhois(info *WhoisInfo) {
+	if info.Error != "" {
+		return
+	}
+	name := strings.ToLower(info.DomainName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.lookups[name]
+	l.addWhois(info)
+	s.lookups[name] = l
+	s.rescoreRisk(name)
+}
+
+// noteDNS remembers a DNS result and rescores the domain's risk.
+func (s *Server) noteDNS(info *DNSInfo) {
+	if info.Error != "" {
+		return
+	}
+	name := strings.ToLower(info.Domain)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.lookups[name]
+	l.addDNS(info)
+	s.lookups[name] = l
+	s.rescoreRisk(name)
+}
+
+// loadLookups summarizes the stored WHOIS and DNS results.
+func (s *Server) loadLookups() (map[string]lookupSummary, error) {
+	lookups := make(map[string]lookupSummary)
+	err := s.store.ForEachLookup(func(key string, value json.RawMessage) error {
+		kind, name, _ := strings.Cut(key, ":")
+		name = strings.ToLower(name)
+		l := lookups[name]
+
+		var err error
+		switch kind {
+		case "whois":
+			var info WhoisInfo
+			if err = json.Unmarshal(value, &info); err == nil && info.Error == "" {
+				l.addWhois(&info)
+			}
+		case "dns":
+			var info DNSInfo
+			if err = json.Unmarshal(value, &info); err == nil && info.Error == "" {
+				l.addDNS(&info)
+			}
+		default:
+			return nil
+		}
+		if err != nil {
+			log.Printf("Error decoding stored %s: %v", key, err)
+			return nil
+		}
+		lookups[name] = l
+		return nil
+	})
+	return lookups, err
+}
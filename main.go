@@ -1,16 +1,11 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
-	"fmt"
+	"flag"
 	"log"
 	"net/http"
 	"os"
-	"regexp"
 	"runtime"
-	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +16,20 @@ import (
 
 type Server struct {
 	domains         []Domain
+	index           map[string]int // domain name -> position in domains
+	search          *searchIndex
+	version         uint64                   // bumped whenever domains is replaced
+	lookups         map[string]lookupSummary // domain -> what WHOIS/DNS lookups found
+	brands          []Brand
+	watchMu         sync.RWMutex // guards watchlists
+	watchlists      map[string]*compiledWatchlist
+	removed         []RemovedDomain
+	seen            map[string]seenRecord
+	store           Store
+	statusMu        sync.Mutex     // guards ingestion, sourceStatus and lastCheck
+	ingestion       []IngestReport // one per source, from the last fetch
+	sourceStatus    map[string]*SourceStatus
+	lastCheck       time.Time
 	stats           DomainStats
 	mu              sync.RWMutex
 	lastUpdate      time.Time
@@ -28,18 +37,124 @@ type Server struct {
 	workers         *WorkerPool
 	similarityCache map[string]*CachedData
 	similarityMu    sync.RWMutex
-}
-
-type CachedData struct {
-	Data      []SimilarityData
-	Timestamp time.Time
+	sources         []FeedSource
+	refresh         chan struct{}
 }
 
 func main() {
+	var sourceSpecs sourceFlags
+	flag.Var(&sourceSpecs, "source", "feed source: URL, file:PATH, dir:PATH, zone:DIR of CZDS snapshots, ct:LOG-URL or - for stdin (repeatable)")
+	dbFile := flag.String("db", "domainmon.db", "database for domains, health and lookups (empty to keep everything in memory)")
+	pslFile := flag.String("psl", "", "public suffix list to use instead of the embedded copy")
+	snapshotFile := flag.String("snapshot", "", "load a snapshot written by -export-snapshot or /api/v1/admin/snapshot on startup")
+	exportFile := flag.String("export-snapshot", "", "write a snapshot of the -db state to this file and exit")
+	brandsFile := flag.String("brands", "", "file of brand domains, one per line, to score new domains against")
+	confusablesFile := flag.String("confusables", "", "Unicode confusables.txt to use instead of the embedded subset")
+	riskFile := flag.String("risk", "", "JSON file of risk signal weights and lists, see README")
+	luresFile := flag.String("lures", "", "file of words, one per line, that make a domain with a brand name in it a combosquat")
+	flag.Parse()
+
+	if *pslFile != "" {
+		list, err := loadSuffixList(*pslFile)
+		if err != nil {
+			log.Fatalf("Error loading %s: %v", *pslFile, err)
+		}
+		publicSuffixes = list
+	}
+
+	if len(sourceSpecs) == 0 {
+		sourceSpecs = sourceFlags{defaultFeedURL}
+	}
+
 	server := &Server{
 		cache:           NewCache(15 * time.Minute),
 		workers:         NewWorkerPool(runtime.NumCPU() * 2),
 		similarityCache: make(map[string]*CachedData),
+		refresh:         make(chan struct{}, 1),
+		sourceStatus:    make(map[string]*SourceStatus),
+		lookups:         make(map[string]lookupSummary),
+		store:           newMemoryStore(),
+	}
+
+	if *dbFile != "" {
+		store, err := OpenBoltStore(*dbFile)
+		if err != nil {
+			log.Fatalf("Error opening %s: %v", *dbFile, err)
+		}
+		defer store.Close()
+		server.store = store
+	}
+
+	if err := server.loadState(); err != nil {
+		log.Fatalf("Error loading state: %v", err)
+	}
+
+	if *snapshotFile != "" {
+		snap, err := readSnapshot(*snapshotFile)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", *snapshotFile, err)
+		}
+		if err := server.restoreSnapshot(snap); err != nil {
+			log.Fatalf("Error restoring %s: %v", *snapshotFile, err)
+		}
+	}
+
+	if *exportFile != "" {
+		if err := server.exportSnapshot(*exportFile); err != nil {
+			log.Fatalf("Error writing %s: %v", *exportFile, err)
+		}
+		log.Printf("Wrote snapshot to %s", *exportFile)
+		return
+	}
+
+	if *confusablesFile != "" {
+		table, err := loadConfusables(*confusablesFile)
+		if err != nil {
+			log.Fatalf("Error loading %s: %v", *confusablesFile, err)
+		}
+		confusables = table
+	}
+
+	if *luresFile != "" {
+		words, err := loadLures(*luresFile)
+		if err != nil {
+			log.Fatalf("Error loading %s: %v", *luresFile, err)
+		}
+		lures = words
+	}
+
+	if *brandsFile != "" {
+		brands, err := loadBrands(*brandsFile)
+		if err != nil {
+			log.Fatalf("Error loading %s: %v", *brandsFile, err)
+		}
+		server.brands = brands
+		log.Printf("Scoring domains against %d brands", len(brands))
+	}
+	if *riskFile != "" {
+		model, err := loadRiskConfig(*riskFile)
+		if err != nil {
+			log.Fatalf("Error loading %s: %v", *riskFile, err)
+		}
+		riskScorer = model
+	}
+
+	// Stored scores may be from a different brand list or risk weights
+	server.rescoreDomains()
+
+	if err := server.loadWatchlists(); err != nil {
+		log.Fatalf("Error loading watchlists: %v", err)
+	}
+
+	for _, spec := range sourceSpecs {
+		src, err := ParseSource(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if w, ok := src.(watcher); ok {
+			go w.Watch(server.refresh)
+		}
+		server.sources = append(server.sources, src)
 	}
 
 	server.workers.Start(server)
@@ -65,6 +180,9 @@ func main() {
 		r.Get("/domains/removed", server.handleRemovedDomains)
 		r.Get("/domains/stats", server.handleStats)
 		r.Get("/domains/health", server.handleDomainHealth)
+		r.Get("/domains/{name}/history", server.handleHealthHistory)
+		r.Get("/ingestion", server.handleIngestion)
+		r.Get("/sources", server.handleSources)
 		r.Get("/tlds", server.handleTLDs)
 		r.Get("/tlds/{tld}", server.handleTLDDomains)
 		r.Get("/lookup/whois", server.handleWhoisLookup)
@@ -72,16 +190,51 @@ func main() {
 
 		// Add similarity endpoint
 		r.Get("/similarity/{threshold}", server.handleSimilarity)
+		r.Get("/similarity/{threshold}/{target}", server.handleSimilarityTarget)
+		r.Get("/confusables", server.handleConfusables)
+		r.Get("/permutations", server.handlePermutations)
+		r.Get("/combosquats", server.handleCombosquats)
+
+		r.Get("/watchlists", server.handleWatchlists)
+		r.Get("/watchlists/{id}", server.handleWatchlist)
+		r.Get("/watchlists/{id}/matches", server.handleWatchMatches)
+		r.Group(func(r chi.Router) {
+			r.Use(server.authenticate)
+			r.Post("/watchlists", server.handleCreateWatchlist)
+			r.Put("/watchlists/{id}", server.handleUpdateWatchlist)
+			r.Delete("/watchlists/{id}", server.handleDeleteWatchlist)
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(server.authenticate)
+			r.Get("/snapshot", server.handleSnapshotExport)
+		})
 	})
 
-	// Serve static files
+	// Serve the frontend. Only its assets, the working directory also holds
+	// the database and the source.
 	workDir, _ := os.Getwd()
-	filesDir := http.Dir(workDir)
+	filesDir := frontendFS{http.Dir(workDir)}
 	FileServer(r, "/", filesDir)
 
 	log.Fatal(http.ListenAndServe(":8080", r))
 }
 
+// frontendFS only opens index.html and the frontend's asset directories.
+type frontendFS struct {
+	root http.FileSystem
+}
+
+func (f frontendFS) Open(name string) (http.File, error) {
+	switch {
+	case name == "/", name == "/index.html":
+	case strings.HasPrefix(name, "/css/"), strings.HasPrefix(name, "/js/"), strings.HasPrefix(name, "/assets/"):
+	default:
+		return nil, os.ErrNotExist
+	}
+	return f.root.Open(name)
+}
+
 // FileServer is a convenience function for serving static files
 func FileServer(r chi.Router, path string, root http.FileSystem) {
 	if strings.ContainsAny(path, "{}*") {
@@ -100,140 +253,3 @@ func FileServer(r chi.Router, path string, root http.FileSystem) {
 		fs.ServeHTTP(w, r)
 	}))
 }
-
-type SimilarityData struct {
-	TargetDomain string   `json:"targetDomain"`
-	Count        int      `json:"count"`
-	Examples     []string `json:"examples"`
-	Similarity   float64  `json:"similarity"`
-}
-
-type SimilarityResponse struct {
-	Data []SimilarityData `json:"data"`
-}
-
-func (s *Server) handleSimilarity(w http.ResponseWriter, r *http.Request) {
-	threshold := chi.URLParam(r, "threshold")
-	if threshold == "" {
-		http.Error(w, "threshold parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	log.Printf("Fetching similarity data for threshold: %s", threshold)
-
-	data, err := s.fetchAndCacheSimilarityData(threshold)
-	if err != nil {
-		log.Printf("Error fetching similarity data: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
-
-	response := SimilarityResponse{Data: data}
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
-	}
-}
-
-func (s *Server) fetchAndCacheSimilarityData(threshold string) ([]SimilarityData, error) {
-	s.similarityMu.RLock()
-	if cached, ok := s.similarityCache[threshold]; ok {
-		if time.Since(cached.Timestamp) < time.Hour {
-			s.similarityMu.RUnlock()
-			return cached.Data, nil
-		}
-	}
-	s.similarityMu.RUnlock()
-
-	// Create a custom HTTP client with timeout and proper headers
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:       10,
-			IdleConnTimeout:    30 * time.Second,
-			DisableCompression: true,
-		},
-	}
-
-	// Update URL to use the new f500_domains path
-	url := fmt.Sprintf("https://codeberg.org/webamon/newly_registered_domains/raw/branch/main/monitoring_output/f500_domains/similarity_%s.txt", threshold)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
-	}
-
-	// Add necessary headers
-	req.Header.Set("User-Agent", "DomainSentinel/1.0")
-	req.Header.Set("Accept", "text/plain")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch similarity data: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	scanner := bufio.NewScanner(resp.Body)
-	similarities := make(map[string]*SimilarityData)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if match := regexp.MustCompile(`(.*?) -> (.*?) \(([\d.]+)%\)`).FindStringSubmatch(line); match != nil {
-			newDomain := match[1]
-			targetDomain := match[2]
-			similarity, _ := strconv.ParseFloat(match[3], 64)
-
-			if _, exists := similarities[targetDomain]; !exists {
-				similarities[targetDomain] = &SimilarityData{
-					TargetDomain: targetDomain,
-					Count:        0,
-					Examples:     make([]string, 0, 3),
-					Similarity:   similarity,
-				}
-			}
-
-			similarities[targetDomain].Count++
-			if len(similarities[targetDomain].Examples) < 3 {
-				similarities[targetDomain].Examples = append(similarities[targetDomain].Examples, newDomain)
-			}
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading response: %v", err)
-	}
-
-	if len(similarities) == 0 {
-		return nil, fmt.Errorf("no similarity data found")
-	}
-
-	result := make([]SimilarityData, 0, len(similarities))
-	for _, data := range similarities {
-		result = append(result, *data)
-	}
-
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].Count > result[j].Count
-	})
-
-	if len(result) > 10 {
-		result = result[:10]
-	}
-
-	s.similarityMu.Lock()
-	s.similarityCache[threshold] = &CachedData{
-		Data:      result,
-		Timestamp: time.Now(),
-	}
-	s.similarityMu.Unlock()
-
-	return result, nil
-}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort fields accepted by domain listings. Ties are always broken by name so
+// the order is total, which is what makes keyset cursors work.
+var sortFields = map[string]bool{
+	"name":          true,
+	"tld":           true,
+	"first_seen":    true,
+	"response_time": true,
+	"status":        true,
+	"risk":          true,
+}
+
+// listOptions controls the order and the page of a domain listing. Either
+// after (cursor paging) or offset (page numbers) is used.
+type listOptions struct {
+	sort   string
+	desc   bool
+	limit  int
+	offset int
+	after  *listCursor
+
+	// Limits for expensive searches; zero means none
+	deadline   time.Time
+	maxMatches int
+
+	facets bool
+}
+
+// listCursor is the last domain of a page. Since results are ordered by
+// (sort key, name), the next page is everything after it, which holds even
+// if the snapshot was replaced in between.
+type listCursor struct {
+	Version uint64 `json:"v"`
+	Sort    string `json:"s"`
+	Desc    bool   `json:"d,omitempty"`
+	Name    string `json:"n"`
+	TLD     string `json:"t,omitempty"`
+	Key     int64  `json:"k,omitempty"`
+}
+
+// listResult is one page of a domain listing.
+type listResult struct {
+	Domains         []Domain `json:"domains"`
+	Total           int      `json:"total"`
+	Page            int      `json:"page,omitempty"`
+	Limit           int      `json:"limit"`
+	Sort            string   `json:"sort"`
+	Order           string   `json:"order"`
+	NextCursor      string   `json:"next_cursor,omitempty"`
+	Version         uint64   `json:"version"`
+	SnapshotChanged bool     `json:"snapshot_changed,omitempty"`
+	Truncated       bool     `json:"truncated,omitempty"` // a search limit was hit, total is a lower bound
+	Facets          *Facets  `json:"facets,omitempty"`
+}
+
+// parseListOptions reads limit, page, sort, order, cursor and facets. A
+// cursor carries its own sort and order, so those parameters are ignored
+// with one.
+func parseListOptions(r *http.Request, defaultSort string, defaultDesc bool) (listOptions, error) {
+	query := r.URL.Query()
+	opts := listOptions{sort: defaultSort, desc: defaultDesc}
+	opts.facets = query.Get("facets") == "true"
+
+	opts.limit, _ = strconv.Atoi(query.Get("limit"))
+	if opts.limit < 1 || opts.limit > 100 {
+		opts.limit = 50
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.after, opts.sort, opts.desc = c, c.Sort, c.Desc
+		return opts, nil
+	}
+
+	if v := query.Get("sort"); v != "" {
+		if !sortFields[v] {
+			return opts, fmt.Errorf("invalid sort %q", v)
+		}
+		opts.sort = v
+	}
+	desc, err := parseOrder(query, opts.desc)
+	if err != nil {
+		return opts, err
+	}
+	opts.desc = desc
+
+	if page, _ := strconv.Atoi(query.Get("page")); page > 1 {
+		opts.offset = (page - 1) * opts.limit
+	}
+	return opts, nil
+}
+
+func decodeCursor(v string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || !sortFields[c.Sort] {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+func encodeCursor(d *Domain, opts listOptions, version uint64) string {
+	c := listCursor{Version: version, Sort: opts.sort, Desc: opts.desc, Name: d.Name}
+	switch opts.sort {
+	case "tld":
+		c.TLD = d.TLD
+	case "first_seen":
+		c.Key = d.FirstSeen.UnixNano()
+	case "response_time":
+		c.Key = int64(d.Health.ResponseTime)
+	case "status":
+		c.Key = int64(d.Health.StatusCode)
+	case "risk":
+		c.Key = int64(riskScore(d))
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// domain rebuilds enough of the cursor's domain to compare against.
+func (c *listCursor) domain() *Domain {
+	return &Domain{
+		Name:      c.Name,
+		TLD:       c.TLD,
+		FirstSeen: time.Unix(0, c.Key),
+		Health: DomainHealth{
+			ResponseTime: time.Duration(c.Key),
+			StatusCode:   int(c.Key),
+		},
+		Risk: &Risk{Score: int(c.Key)},
+	}
+}
+
+// compareDomains orders a and b by field, then by name.
+func compareDomains(a, b *Domain, field string) int {
+	var c int
+	switch field {
+	case "tld":
+		c = strings.Compare(a.TLD, b.TLD)
+	case "first_seen":
+		c = a.FirstSeen.Compare(b.FirstSeen)
+	case "response_time":
+		c = cmp.Compare(a.Health.ResponseTime, b.Health.ResponseTime)
+	case "status":
+		c = cmp.Compare(a.Health.StatusCode, b.Health.StatusCode)
+	case "risk":
+		c = cmp.Compare(riskScore(a), riskScore(b))
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+// topInsertMax is the largest n topDomains keeps by insertion. Each insert
+// moves up to n positions, so deep pages collect every match and sort once.
+const topInsertMax = 1024
+
+// topDomains keeps the n smallest positions seen so far according to less,
+// which is all a page needs and much cheaper than sorting every match.
+type topDomains struct {
+	n    int
+	less func(a, b int32) bool
+	top  []int32
+}
+
+func (t *topDomains) add(i int32) {
+	if t.n > topInsertMax {
+		t.top = append(t.top, i)
+		return
+	}
+	if len(t.top) == t.n {
+		if t.n == 0 || !t.less(i, t.top[t.n-1]) {
+			return
+		}
+	} else {
+		t.top = append(t.top, 0)
+	}
+
+	j := sort.Search(len(t.top)-1, func(k int) bool { return t.less(i, t.top[k]) })
+	copy(t.top[j+1:], t.top[j:len(t.top)-1])
+	t.top[j] = i
+}
+
+// positions returns the kept positions in order.
+func (t *topDomains) positions() []int32 {
+	if t.n > topInsertMax {
+		sort.Slice(t.top, func(a, b int) bool { return t.less(t.top[a], t.top[b]) })
+		t.top = t.top[:min(t.n, len(t.top))]
+	}
+	return t.top
+}
+
+func writeDomainList(w http.ResponseWriter, res listResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
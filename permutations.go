@@ -0,0 +1,198 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// commonTLDs are always tried by the tld-swap fuzzer, on top of every TLD
+// seen in the feed.
+var commonTLDs = []string{
+	"com", "net", "org", "info", "biz", "co", "io", "me", "xyz", "online",
+	"site", "top", "shop", "store", "app", "dev", "us", "uk", "co.uk", "de",
+}
+
+// Permutation is a typosquatting candidate for a domain.
+type Permutation struct {
+	Fuzzer      string        `json:"fuzzer"`
+	Domain      string        `json:"domain"`
+	Unicode     string        `json:"unicode,omitempty"`
+	Registrable string        `json:"registrable_domain"` // what is looked up in the feed
+	Registered  bool          `json:"registered"`
+	FirstSeen   *time.Time    `json:"first_seen,omitempty"`
+	Health      *DomainHealth `json:"health,omitempty"`
+}
+
+// permutations generates typosquatting candidates for domain in the manner
+// of dnstwist. Each candidate appears once, under the first fuzzer that
+// produced it, and the domain itself is left out.
+func permutations(domain string, tlds []string) []Permutation {
+	tld := publicSuffixes.PublicSuffix(domain)
+	label := strings.TrimSuffix(domain, "."+tld)
+
+	var result []Permutation
+	seen := map[string]bool{domain: true}
+	add := func(fuzzer, name string) {
+		name, err := normalizeDomain(name)
+		if err != nil || seen[name] || validateHostname(name) != nil {
+			return
+		}
+		registrable := publicSuffixes.Registrable(name)
+		if registrable == "" {
+			return
+		}
+		seen[name] = true
+		result = append(result, Permutation{
+			Fuzzer:      fuzzer,
+			Domain:      name,
+			Unicode:     toUnicode(name),
+			Registrable: registrable,
+		})
+	}
+	addLabel := func(fuzzer, l string) {
+		add(fuzzer, l+"."+tld)
+	}
+
+	for i := range label {
+		addLabel("omission", label[:i]+label[i+1:])
+	}
+
+	for i := 1; i < len(label); i++ {
+		addLabel("hyphenation", label[:i]+"-"+label[i:])
+	}
+
+	for i := range label {
+		for _, k := range []byte(keyboardAdjacent[label[i]]) {
+			addLabel("insertion", label[:i]+string(k)+label[i:])
+			addLabel("insertion", label[:i+1]+string(k)+label[i+1:])
+		}
+	}
+
+	for i := 0; i+1 < len(label); i++ {
+		if label[i] != label[i+1] {
+			addLabel("transposition", label[:i]+string(label[i+1])+string(label[i])+label[i+2:])
+		}
+	}
+
+	for i := range label {
+		addLabel("repetition", label[:i+1]+label[i:])
+	}
+
+	for i := range label {
+		for bit := 0; bit < 8; bit++ {
+			c := label[i] ^ (1 << bit)
+			if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' {
+				addLabel("bitsquatting", label[:i]+string(c)+label[i+1:])
+			}
+		}
+	}
+
+	const vowels = "aeiou"
+	for i := range label {
+		if strings.IndexByte(vowels, label[i]) < 0 {
+			continue
+		}
+		for _, v := range []byte(vowels) {
+			addLabel("vowel-swap", label[:i]+string(v)+label[i+1:])
+		}
+	}
+
+	for i := 1; i < len(label); i++ {
+		if label[i-1] != '-' && label[i] != '-' && label[i-1] != '.' && label[i] != '.' {
+			addLabel("subdomain", label[:i]+"."+label[i:])
+		}
+	}
+
+	glyphs := homoglyphs()
+	var sequences []string // prototypes longer than a character, like rn
+	for prototype := range glyphs {
+		if len(prototype) > 1 {
+			sequences = append(sequences, prototype)
+		}
+	}
+	sort.Strings(sequences)
+	for i := range label {
+		for _, g := range glyphs[label[i:i+1]] {
+			addLabel("homoglyph", label[:i]+g+label[i+1:])
+			// Every occurrence too, which is how pаypаl.com is built
+			addLabel("homoglyph", strings.ReplaceAll(label, label[i:i+1], g))
+		}
+		// And the other way round, m for rn
+		if prototype, ok := confusables[rune(label[i])]; ok {
+			addLabel("homoglyph", label[:i]+strings.ToLower(prototype)+label[i+1:])
+		}
+		for _, prototype := range sequences {
+			if strings.HasPrefix(label[i:], prototype) {
+				for _, g := range glyphs[prototype] {
+					addLabel("homoglyph", label[:i]+g+label[i+len(prototype):])
+				}
+			}
+		}
+	}
+
+	for _, t := range tlds {
+		if t != tld {
+			add("tld-swap", label+"."+t)
+		}
+	}
+
+	return result
+}
+
+// homoglyphs inverts the confusables table: for each lowercase prototype,
+// the characters that pass for it.
+func homoglyphs() map[string][]string {
+	glyphs := make(map[string][]string)
+	for r, prototype := range confusables {
+		if unicode.IsUpper(r) {
+			continue
+		}
+		p := strings.ToLower(prototype)
+		glyphs[p] = append(glyphs[p], string(r))
+	}
+	// Map iteration order is random, keep the output stable
+	for _, g := range glyphs {
+		sort.Strings(g)
+	}
+	return glyphs
+}
+
+// feedTLDs returns the TLDs of the current snapshot along with commonTLDs.
+func (s *Server) feedTLDs() []string {
+	set := make(map[string]bool)
+	for _, tld := range commonTLDs {
+		set[tld] = true
+	}
+
+	s.mu.RLock()
+	for tld := range s.stats.DomainsPerTLD {
+		set[tld] = true
+	}
+	s.mu.RUnlock()
+
+	tlds := make([]string, 0, len(set))
+	for tld := range set {
+		tlds = append(tlds, tld)
+	}
+	sort.Strings(tlds)
+	return tlds
+}
+
+// markRegistered fills in which permutations are in the feed.
+func (s *Server) markRegistered(perms []Permutation) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range perms {
+		j, ok := s.index[perms[i].Registrable]
+		if !ok {
+			continue
+		}
+		d := s.domains[j]
+		perms[i].Registered = true
+		perms[i].FirstSeen = &d.FirstSeen
+		perms[i].Health = &d.Health
+	}
+}
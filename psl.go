@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+//go:embed data/public_suffix_list.dat
+var embeddedPSL string
+
+// publicSuffixes is used to split every ingested domain into its effective
+// TLD and registrable domain. It can be replaced at startup with -psl.
+var publicSuffixes = mustParseSuffixList(strings.NewReader(embeddedPSL))
+
+const (
+	ruleNormal byte = iota + 1
+	ruleWildcard
+	ruleException
+)
+
+// suffixList holds the ICANN section of the Public Suffix List. Private
+// entries (blogspot.com, github.io, ...) are left out on purpose: we care
+// about what was registered with a registry, not hosting sub-delegations.
+type suffixList struct {
+	rules map[string]byte
+}
+
+func loadSuffixList(path string) (*suffixList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseSuffixList(f)
+}
+
+func mustParseSuffixList(r io.Reader) *suffixList {
+	l, err := parseSuffixList(r)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+func parseSuffixList(r io.Reader) (*suffixList, error) {
+	l := &suffixList{rules: make(map[string]byte)}
+
+	scanner := bufio.NewScanner(r)
+	icann := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.Contains(line, "===BEGIN ICANN DOMAINS==="):
+			icann = true
+			continue
+		case strings.Contains(line, "===END ICANN DOMAINS==="):
+			icann = false
+			continue
+		case !icann || line == "" || strings.HasPrefix(line, "//"):
+			continue
+		}
+
+		// Rules end at the first whitespace
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			line = line[:i]
+		}
+
+		kind := ruleNormal
+		switch {
+		case strings.HasPrefix(line, "!"):
+			kind, line = ruleException, line[1:]
+		case strings.HasPrefix(line, "*."):
+			kind, line = ruleWildcard, line[2:]
+		}
+
+		rule, err := idna.ToASCII(line)
+		if err != nil {
+			continue
+		}
+		l.rules[strings.ToLower(rule)] = kind
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.rules) == 0 {
+		return nil, fmt.Errorf("no ICANN rules found in public suffix list")
+	}
+	return l, nil
+}
+
+// PublicSuffix returns the effective TLD of domain, e.g. "co.uk" for
+// "www.example.co.uk". Unknown TLDs fall back to the last label.
+func (l *suffixList) PublicSuffix(domain string) string {
+	labels := strings.Split(domain, ".")
+
+	for i := range labels {
+		name := strings.Join(labels[i:], ".")
+		switch l.rules[name] {
+		case ruleException:
+			return strings.Join(labels[i+1:], ".")
+		case ruleNormal:
+			return name
+		}
+
+		if i+1 < len(labels) && l.rules[strings.Join(labels[i+1:], ".")] == ruleWildcard {
+			return name
+		}
+	}
+
+	return labels[len(labels)-1]
+}
+
+// Registrable returns the effective TLD plus one label, e.g. "example.co.uk"
+// for "www.example.co.uk". It is empty when domain is itself a public suffix.
+func (l *suffixList) Registrable(domain string) string {
+	suffix := l.PublicSuffix(domain)
+	if len(domain) <= len(suffix) {
+		return ""
+	}
+
+	rest := domain[:len(domain)-len(suffix)-1]
+	if i := strings.LastIndex(rest, "."); i >= 0 {
+		rest = rest[i+1:]
+	}
+	return rest + "." + suffix
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRegistrable runs the usual Public Suffix List test cases against the
+// embedded list.
+func TestRegistrable(t *testing.T) {
+	tests := []struct {
+		domain      string
+		suffix      string
+		registrable string
+	}{
+		// A bare suffix has no registrable domain
+		{"com", "com", ""},
+		{"example.com", "com", "example.com"},
+		{"b.example.com", "com", "example.com"},
+		{"a.b.example.com", "com", "example.com"},
+
+		// Multi-label suffixes
+		{"co.uk", "co.uk", ""},
+		{"example.co.uk", "co.uk", "example.co.uk"},
+		{"www.example.co.uk", "co.uk", "example.co.uk"},
+		{"uk", "uk", ""},
+		{"example.uk", "uk", "example.uk"},
+
+		// *.ck with the exception !www.ck
+		{"ck", "ck", ""},
+		{"test.ck", "test.ck", ""},
+		{"b.test.ck", "test.ck", "b.test.ck"},
+		{"a.b.test.ck", "test.ck", "b.test.ck"},
+		{"www.ck", "ck", "www.ck"},
+		{"www.www.ck", "ck", "www.ck"},
+
+		// *.kawasaki.jp with the exception !city.kawasaki.jp
+		{"kawasaki.jp", "jp", "kawasaki.jp"},
+		{"test.kawasaki.jp", "test.kawasaki.jp", ""},
+		{"b.test.kawasaki.jp", "test.kawasaki.jp", "b.test.kawasaki.jp"},
+		{"city.kawasaki.jp", "kawasaki.jp", "city.kawasaki.jp"},
+		{"www.city.kawasaki.jp", "kawasaki.jp", "city.kawasaki.jp"},
+
+		// Unknown TLDs fall back to the last label
+		{"example", "example", ""},
+		{"example.example", "example", "example.example"},
+		{"b.example.example", "example", "example.example"},
+
+		// Private entries are ignored on purpose
+		{"example.blogspot.com", "com", "blogspot.com"},
+		{"user.github.io", "io", "github.io"},
+
+		// IDNs, in the ASCII form names are stored in
+		{"xn--p1ai", "xn--p1ai", ""},
+		{"xn--80ak6aa92e.xn--p1ai", "xn--p1ai", "xn--80ak6aa92e.xn--p1ai"},
+		{"xn--85x722f.com.cn", "com.cn", "xn--85x722f.com.cn"},
+		{"www.xn--85x722f.xn--55qx5d.cn", "xn--55qx5d.cn", "xn--85x722f.xn--55qx5d.cn"},
+		{"shishi.xn--fiqs8s", "xn--fiqs8s", "shishi.xn--fiqs8s"},
+	}
+
+	for _, tt := range tests {
+		if got := publicSuffixes.PublicSuffix(tt.domain); got != tt.suffix {
+			t.Errorf("PublicSuffix(%q) = %q, want %q", tt.domain, got, tt.suffix)
+		}
+		if got := publicSuffixes.Registrable(tt.domain); got != tt.registrable {
+			t.Errorf("Registrable(%q) = %q, want %q", tt.domain, got, tt.registrable)
+		}
+	}
+}
+
+// TestParseDomainSuffix checks that Unicode names are converted before the
+// list is consulted.
+func TestParseDomainSuffix(t *testing.T) {
+	tests := []struct {
+		line        string
+		tld         string
+		registrable string
+	}{
+		{"WWW.Example.CO.UK", "co.uk", "example.co.uk"},
+		{"www.食狮.公司.cn", "xn--55qx5d.cn", "xn--85x722f.xn--55qx5d.cn"},
+		{"пример.рф", "xn--p1ai", "xn--e1afmkfd.xn--p1ai"},
+	}
+
+	for _, tt := range tests {
+		d, err := parseDomain(tt.line)
+		if err != nil {
+			t.Errorf("parseDomain(%q): %v", tt.line, err)
+			continue
+		}
+		if d.TLD != tt.tld || d.Registrable != tt.registrable {
+			t.Errorf("parseDomain(%q) = TLD %q, registrable %q, want %q and %q", tt.line, d.TLD, d.Registrable, tt.tld, tt.registrable)
+		}
+	}
+}
+
+func TestParseSuffixList(t *testing.T) {
+	list, err := parseSuffixList(strings.NewReader(`// ===BEGIN ICANN DOMAINS===
+com
+*.bd
+!www.bd
+рф
+// ===END ICANN DOMAINS===
+// ===BEGIN PRIVATE DOMAINS===
+github.io
+// ===END PRIVATE DOMAINS===
+`))
+	if err != nil {
+		t.Fatalf("parseSuffixList: %v", err)
+	}
+
+	tests := map[string]string{
+		"example.com":      "example.com",
+		"a.example.bd":     "a.example.bd",
+		"www.bd":           "www.bd",
+		"example.xn--p1ai": "example.xn--p1ai",
+		"user.github.io":   "github.io",
+	}
+	for domain, want := range tests {
+		if got := list.Registrable(domain); got != want {
+			t.Errorf("Registrable(%q) = %q, want %q", domain, got, want)
+		}
+	}
+
+	if _, err := parseSuffixList(strings.NewReader("com\nnet\n")); err == nil {
+		t.Errorf("parseSuffixList accepted a list without an ICANN section")
+	}
+}
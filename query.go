@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query is a compiled filter expression for /api/v1/domains?q=.
+//
+// Terms are field:value pairs or bare words (substring match on the name).
+// Terms next to each other are ANDed; OR, NOT (or a leading -) and
+// parentheses work as expected, AND binds tighter than OR.
+//
+//	tld:com hyphens:>0 online:true
+//	(tld:com OR tld:net) AND NOT status:5xx
+//	first_seen:2026-10-01..2026-10-07 len:<=12 -prefix:www
+//
+// Numeric fields (len, digits, hyphens, risk, status) take n, >n, >=n, <n,
+// <=n or a..b; status also takes a class such as 4xx. Time fields
+// (first_seen or created, last_seen) take a date, RFC 3339 time or Unix
+// seconds with the same operators, and age takes a duration (age:<48h).
+type Query struct {
+	match func(d *Domain) bool
+
+	// Terms every match must satisfy, which lets the search index narrow
+	// down candidates before match is run
+	required []searchTerm
+}
+
+func (q *Query) Match(d *Domain) bool {
+	return q.match(d)
+}
+
+// QueryError describes why a query could not be parsed.
+type QueryError struct {
+	Pos int // offset of the offending token in the query
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos, e.Msg)
+}
+
+type queryToken struct {
+	text string
+	pos  int
+}
+
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return &Query{match: func(*Domain) bool { return true }}, nil
+	}
+
+	p := &queryParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		return nil, &QueryError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+
+	return &Query{match: node.match, required: node.required}, nil
+}
+
+func tokenizeQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, queryToken{text: string(c), pos: i})
+			i++
+		default:
+			start := i
+			var b strings.Builder
+			for i < len(input) && !strings.ContainsRune(" \t\n()", rune(input[i])) {
+				if input[i] == '"' {
+					end := strings.IndexByte(input[i+1:], '"')
+					if end < 0 {
+						return nil, &QueryError{Pos: i, Msg: "unterminated quote"}
+					}
+					b.WriteString(input[i+1 : i+1+end])
+					i += end + 2
+					continue
+				}
+				b.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, queryToken{text: b.String(), pos: start})
+		}
+	}
+
+	return tokens, nil
+}
+
+// queryNode is a compiled subexpression. required only holds terms that are
+// implied by the whole subexpression, so OR and NOT drop them.
+type queryNode struct {
+	match    func(*Domain) bool
+	required []searchTerm
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return queryNode{}, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.text != "OR" {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return queryNode{}, err
+		}
+		l, r := left.match, right.match
+		left = queryNode{match: func(d *Domain) bool { return l(d) || r(d) }}
+	}
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return queryNode{}, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.text == "OR" || tok.text == ")" {
+			return left, nil
+		}
+		if tok.text == "AND" {
+			p.pos++
+		}
+
+		right, err := p.parseNot()
+		if err != nil {
+			return queryNode{}, err
+		}
+		l, r := left.match, right.match
+		left = queryNode{
+			match:    func(d *Domain) bool { return l(d) && r(d) },
+			required: append(left.required, right.required...),
+		}
+	}
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return queryNode{}, &QueryError{Pos: p.endPos(), Msg: "expected a term"}
+	}
+
+	// A - on its own, as in -(tld:com OR tld:net), negates like NOT
+	if tok.text == "NOT" || tok.text == "-" {
+		p.pos++
+		inner, err := p.parseNot()
+		if err != nil {
+			return queryNode{}, err
+		}
+		return queryNode{match: func(d *Domain) bool { return !inner.match(d) }}, nil
+	}
+
+	if len(tok.text) > 1 && tok.text[0] == '-' {
+		p.tokens[p.pos].text = tok.text[1:]
+		p.tokens[p.pos].pos++
+		inner, err := p.parsePrimary()
+		if err != nil {
+			return queryNode{}, err
+		}
+		return queryNode{match: func(d *Domain) bool { return !inner.match(d) }}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return queryNode{}, &QueryError{Pos: p.endPos(), Msg: "expected a term"}
+	}
+
+	switch tok.text {
+	case "(":
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return queryNode{}, err
+		}
+		if next, ok := p.peek(); !ok || next.text != ")" {
+			return queryNode{}, &QueryError{Pos: tok.pos, Msg: "unclosed parenthesis"}
+		}
+		p.pos++
+		return inner, nil
+	case ")", "AND", "OR":
+		return queryNode{}, &QueryError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+
+	p.pos++
+	match, err := compileTerm(tok)
+	if err != nil {
+		return queryNode{}, err
+	}
+	return queryNode{match: match, required: termHint(tok.text)}, nil
+}
+
+func (p *queryParser) endPos() int {
+	if len(p.tokens) == 0 {
+		return 0
+	}
+	last := p.tokens[len(p.tokens)-1]
+	return last.pos + len(last.text)
+}
+
+func compileTerm(tok queryToken) (func(*Domain) bool, error) {
+	field, value, ok := strings.Cut(tok.text, ":")
+	if !ok {
+		word := strings.ToLower(tok.text)
+		return func(d *Domain) bool {
+			return strings.Contains(d.Name, word) || strings.Contains(d.Unicode, word)
+		}, nil
+	}
+
+	fail := func(format string, args ...interface{}) (func(*Domain) bool, error) {
+		return nil, &QueryError{Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+	}
+	if value == "" {
+		return fail("missing value for %s", field)
+	}
+	value = strings.ToLower(value)
+
+	switch strings.ToLower(field) {
+	case "name", "contains":
+		return func(d *Domain) bool {
+			return strings.Contains(d.Name, value) || strings.Contains(d.Unicode, value)
+		}, nil
+	case "tld":
+		tld := strings.TrimPrefix(value, ".")
+		return func(d *Domain) bool { return d.TLD == tld }, nil
+	case "prefix":
+		return func(d *Domain) bool { return strings.HasPrefix(d.Name, value) }, nil
+	case "suffix":
+		// Matched against the name without its TLD, so suffix:shop finds
+		// bestshop.com and bestshop.co.uk alike
+		return func(d *Domain) bool { return strings.HasSuffix(nameLabel(d), value) }, nil
+	case "source":
+		return func(d *Domain) bool {
+			for _, src := range d.Sources {
+				if strings.Contains(strings.ToLower(src), value) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "online", "mixed_script":
+		want, err := strconv.ParseBool(value)
+		if err != nil {
+			return fail("%s expects true or false, got %q", field, value)
+		}
+		if strings.ToLower(field) == "online" {
+			return func(d *Domain) bool { return d.Health.IsOnline == want }, nil
+		}
+		return func(d *Domain) bool { return d.MixedScript == want }, nil
+	case "len", "length":
+		cmp, err := parseIntRange(value)
+		if err != nil {
+			return fail("%s: %v", field, err)
+		}
+		return func(d *Domain) bool { return cmp(int64(len(nameLabel(d)))) }, nil
+	case "risk":
+		cmp, err := parseIntRange(value)
+		if err != nil {
+			return fail("%s: %v", field, err)
+		}
+		return func(d *Domain) bool { return cmp(int64(riskScore(d))) }, nil
+	case "digits":
+		cmp, err := parseIntRange(value)
+		if err != nil {
+			return fail("%s: %v", field, err)
+		}
+		return func(d *Domain) bool { return cmp(int64(countDigits(nameLabel(d)))) }, nil
+	case "hyphens":
+		cmp, err := parseIntRange(value)
+		if err != nil {
+			return fail("%s: %v", field, err)
+		}
+		return func(d *Domain) bool { return cmp(int64(strings.Count(nameLabel(d), "-"))) }, nil
+	case "status":
+		if len(value) == 3 && value[1:] == "xx" && value[0] >= '1' && value[0] <= '5' {
+			class := int(value[0]-'0') * 100
+			return func(d *Domain) bool {
+				return d.Health.StatusCode >= class && d.Health.StatusCode < class+100
+			}, nil
+		}
+		cmp, err := parseIntRange(value)
+		if err != nil {
+			return fail("%s: %v", field, err)
+		}
+		return func(d *Domain) bool { return cmp(int64(d.Health.StatusCode)) }, nil
+	case "first_seen", "created":
+		cmp, err := parseTimeRangeValue(value)
+		if err != nil {
+			return fail("%s: %v", field, err)
+		}
+		return func(d *Domain) bool { return cmp(d.FirstSeen.Unix()) }, nil
+	case "last_seen":
+		cmp, err := parseTimeRangeValue(value)
+		if err != nil {
+			return fail("%s: %v", field, err)
+		}
+		return func(d *Domain) bool { return cmp(d.LastSeen.Unix()) }, nil
+	case "age":
+		cmp, err := parseRange(value, func(v string) (int64, int64, error) {
+			dur, err := time.ParseDuration(v)
+			return int64(dur), int64(dur), err
+		})
+		if err != nil {
+			return fail("%s: %v", field, err)
+		}
+		return func(d *Domain) bool { return cmp(int64(time.Since(d.FirstSeen))) }, nil
+	}
+
+	return fail("unknown field %q", field)
+}
+
+// termHint returns the index lookup implied by a name, prefix or bare word
+// term. Terms are already known to be valid here.
+func termHint(text string) []searchTerm {
+	field, value, ok := strings.Cut(text, ":")
+	if !ok {
+		return []searchTerm{{text: strings.ToLower(text)}}
+	}
+
+	switch strings.ToLower(field) {
+	case "name", "contains":
+		return []searchTerm{{text: strings.ToLower(value)}}
+	case "prefix":
+		return []searchTerm{{text: strings.ToLower(value), prefix: true}}
+	}
+	return nil
+}
+
+// nameLabel returns the domain without its effective TLD.
+func nameLabel(d *Domain) string {
+	if len(d.Name) > len(d.TLD) {
+		return d.Name[:len(d.Name)-len(d.TLD)-1]
+	}
+	return d.Name
+}
+
+func countDigits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+func parseIntRange(value string) (func(int64) bool, error) {
+	return parseRange(value, func(v string) (int64, int64, error) {
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, n, err
+	})
+}
+
+// parseTimeRangeValue compares Unix seconds. A bare date covers the whole
+// UTC day, so first_seen:2026-10-01..2026-10-07 includes the 7th.
+func parseTimeRangeValue(value string) (func(int64) bool, error) {
+	return parseRange(value, func(v string) (int64, int64, error) {
+		if t, err := time.Parse("2006-01-02", v); err == nil {
+			return t.Unix(), t.Unix() + 24*60*60 - 1, nil
+		}
+		t, err := parseTimeParam(strings.ToUpper(v))
+		return t.Unix(), t.Unix(), err
+	})
+}
+
+// parseRange turns n, >n, >=n, <n, <=n, =n or a..b into a comparison. parse
+// returns the span an operand covers, which is a single point for numbers.
+func parseRange(value string, parse func(string) (int64, int64, error)) (func(int64) bool, error) {
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		a, _, err := parse(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", lo)
+		}
+		_, b, err := parse(hi)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", hi)
+		}
+		return func(n int64) bool { return n >= a && n <= b }, nil
+	}
+
+	op := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, candidate) {
+			op, value = candidate, value[len(candidate):]
+			break
+		}
+	}
+
+	lo, hi, err := parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", value)
+	}
+
+	switch op {
+	case ">=":
+		return func(n int64) bool { return n >= lo }, nil
+	case "<=":
+		return func(n int64) bool { return n <= hi }, nil
+	case ">":
+		return func(n int64) bool { return n > hi }, nil
+	case "<":
+		return func(n int64) bool { return n < lo }, nil
+	}
+	return func(n int64) bool { return n >= lo && n <= hi }, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func queryTestDomains(t *testing.T) []Domain {
+	t.Helper()
+
+	var domains []Domain
+	for _, name := range []string{"shop.com", "my-shop.net", "bank.org", "login-bank.com", "www.example.co.uk"} {
+		d, err := parseDomain(name)
+		if err != nil {
+			t.Fatalf("parseDomain(%q): %v", name, err)
+		}
+		domains = append(domains, d)
+	}
+	domains[0].Health = DomainHealth{IsOnline: true, StatusCode: 200}
+	domains[3].Health = DomainHealth{IsOnline: true, StatusCode: 503}
+	return domains
+}
+
+func TestParseQuery(t *testing.T) {
+	domains := queryTestDomains(t)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"shop.com", "my-shop.net", "bank.org", "login-bank.com", "www.example.co.uk"}},
+		{"shop", []string{"shop.com", "my-shop.net"}},
+		{"tld:com", []string{"shop.com", "login-bank.com"}},
+		{"tld:co.uk", []string{"www.example.co.uk"}},
+
+		// NOT and a leading -
+		{"NOT tld:com", []string{"my-shop.net", "bank.org", "www.example.co.uk"}},
+		{"-tld:com", []string{"my-shop.net", "bank.org", "www.example.co.uk"}},
+		{"-shop", []string{"bank.org", "login-bank.com", "www.example.co.uk"}},
+		{"bank -login", []string{"bank.org"}},
+		{"NOT NOT tld:org", []string{"bank.org"}},
+
+		// A - before a group negates the group
+		{"-(tld:com OR tld:net)", []string{"bank.org", "www.example.co.uk"}},
+		{"- (tld:com OR tld:net)", []string{"bank.org", "www.example.co.uk"}},
+		{"NOT (tld:com OR tld:net)", []string{"bank.org", "www.example.co.uk"}},
+		{"bank -(tld:org)", []string{"login-bank.com"}},
+
+		// AND binds tighter than OR
+		{"tld:org OR tld:com AND status:200", []string{"shop.com", "bank.org"}},
+		{"(tld:org OR tld:com) AND status:200", []string{"shop.com"}},
+		{"(tld:org OR tld:com) AND online:true", []string{"shop.com", "login-bank.com"}},
+		{"tld:com status:200 OR tld:org", []string{"shop.com", "bank.org"}},
+		{"shop OR bank NOT status:5xx", []string{"shop.com", "my-shop.net", "bank.org"}},
+
+		{"hyphens:>0", []string{"my-shop.net", "login-bank.com"}},
+		{"len:<=4", []string{"shop.com", "bank.org"}},
+		{"status:5xx", []string{"login-bank.com"}},
+		{`"my-shop"`, []string{"my-shop.net"}},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for i := range domains {
+			if q.Match(&domains[i]) {
+				got = append(got, domains[i].Name)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseQuery(%q) matched %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"tld:com AND", 11},
+		{"NOT", 3},
+		{"-", 1},
+		{"(tld:com", 0},
+		{"tld:com (shop OR", 16},
+		{"shop ) bank", 5},
+		{"OR shop", 0},
+		{"shop AND OR bank", 9},
+		{"colour:red", 0},
+		{"shop len:>x", 5},
+		{"tld:", 0},
+		{`shop "bank`, 5},
+		{"-colour:red", 1},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("ParseQuery(%q) = %v, want a QueryError", tt.query, err)
+			continue
+		}
+		if qe.Pos != tt.pos {
+			t.Errorf("ParseQuery(%q) error at %d (%s), want %d", tt.query, qe.Pos, qe.Msg, tt.pos)
+		}
+	}
+}
+
+func TestParseQueryRequired(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []searchTerm
+	}{
+		{"shop tld:com", []searchTerm{{text: "shop"}}},
+		{"prefix:www name:example", []searchTerm{{text: "www", prefix: true}, {text: "example"}}},
+		// Terms under OR or NOT aren't implied by the whole query
+		{"shop OR bank", nil},
+		{"-shop", nil},
+		{"-(shop bank)", nil},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if !slices.Equal(q.required, tt.want) {
+			t.Errorf("ParseQuery(%q) requires %v, want %v", tt.query, q.required, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+)
+
+// riskSignals are the signals a risk score is made of, in the order they
+// are reported.
+var riskSignals = []string{"tld", "entropy", "length", "digits", "hyphens", "brand", "keywords", "health", "whois", "nameservers"}
+
+// RiskConfig is what -risk can change. Weights are the most points each
+// signal adds to the score, which is capped at 100. The lists replace the
+// built-in ones.
+type RiskConfig struct {
+	Weights     map[string]float64 `json:"weights"`
+	TLDs        []string           `json:"tlds"`
+	Registrars  []string           `json:"registrars"`  // matched anywhere in the registrar's name
+	NameServers []string           `json:"nameservers"` // providers, by registrable domain
+}
+
+func defaultRiskConfig() RiskConfig {
+	return RiskConfig{
+		Weights: map[string]float64{
+			"tld":         15,
+			"entropy":     10,
+			"length":      5,
+			"digits":      5,
+			"hyphens":     5,
+			"brand":       30,
+			"keywords":    15,
+			"health":      5,
+			"whois":       5,
+			"nameservers": 5,
+		},
+		TLDs: []string{
+			"xyz", "top", "icu", "online", "site", "shop", "live", "click", "buzz", "monster",
+			"rest", "cfd", "sbs", "quest", "cyou", "lol", "tk", "ml", "ga", "cf", "gq", "zip", "mov",
+		},
+		Registrars:  []string{"nicenic", "gname", "webnic", "dominet"},
+		NameServers: []string{"afraid.org", "freenom.com", "dynu.com"},
+	}
+}
+
+// riskModel is a RiskConfig ready to score domains with.
+type riskModel struct {
+	weights     map[string]float64
+	tlds        map[string]bool
+	registrars  []string
+	nameservers map[string]bool
+}
+
+// riskScorer scores every domain. It is replaced at startup using -risk.
+var riskScorer = newRiskModel(defaultRiskConfig())
+
+func newRiskModel(c RiskConfig) *riskModel {
+	m := &riskModel{
+		weights:     c.Weights,
+		tlds:        make(map[string]bool),
+		nameservers: make(map[string]bool),
+	}
+	for _, tld := range c.TLDs {
+		m.tlds[strings.ToLower(strings.TrimPrefix(tld, "."))] = true
+	}
+	for _, r := range c.Registrars {
+		m.registrars = append(m.registrars, strings.ToLower(r))
+	}
+	for _, ns := range c.NameServers {
+		m.nameservers[strings.ToLower(ns)] = true
+	}
+	return m
+}
+
+// loadRiskConfig reads a JSON RiskConfig. Weights it leaves out keep their
+// defaults.
+func loadRiskConfig(path string) (*riskModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := defaultRiskConfig()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	for signal, weight := range c.Weights {
+		if !slices.Contains(riskSignals, signal) {
+			return nil, fmt.Errorf("unknown signal %q, expected one of %s", signal, strings.Join(riskSignals, ", "))
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("weight of %s is negative", signal)
+		}
+	}
+	return newRiskModel(c), nil
+}
+
+// Risk is how suspicious a domain looks, from 0 to 100, and the signals
+// that added to it.
+type Risk struct {
+	Score   int          `json:"score"`
+	Signals []RiskSignal `json:"signals"`
+}
+
+// RiskSignal is what one signal added to a risk score, and why.
+type RiskSignal struct {
+	Signal string  `json:"signal"`
+	Points float64 `json:"points"`
+	Detail string  `json:"detail"`
+}
+
+// assess scores d. Each signal has a strength from 0 to 1 that scales its
+// weight; l is what lookups found about d.
+func (m *riskModel) assess(d *Domain, l lookupSummary) *Risk {
+	r := &Risk{Signals: make([]RiskSignal, 0)}
+	total := 0.0
+	add := func(signal string, strength float64, format string, args ...interface{}) {
+		points := round(m.weights[signal] * min(strength, 1))
+		if points <= 0 {
+			return
+		}
+		total += points
+		r.Signals = append(r.Signals, RiskSignal{Signal: signal, Points: points, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	label := nameLabel(d)
+	letters := strings.NewReplacer("-", "", ".", "").Replace(label)
+
+	if m.tlds[d.TLD] {
+		add("tld", 1, ".%s is popular for abuse", d.TLD)
+	}
+
+	// Entropy grows with length, so it is compared with the most a name
+	// this long could have. Words sit around 85% of that, random strings
+	// from DGAs close to 100%.
+	if len(letters) >= 8 {
+		h := entropy(letters)
+		most := math.Log2(float64(min(len(letters), 36)))
+		add("entropy", (h/most-0.85)/0.15, "%.2f bits per character, %.0f%% of the most possible", h, 100*h/most)
+	}
+	if n := len(letters); n > 15 {
+		add("length", float64(n-15)/15, "%d characters", n)
+	}
+	if digits := countDigits(letters); digits > 0 && len(letters) > 0 {
+		ratio := float64(digits) / float64(len(letters))
+		add("digits", ratio/0.3, "%d of %d characters are digits", digits, len(letters))
+	}
+	// One hyphen is common enough, several are typical of phishing
+	if hyphens := strings.Count(label, "-"); hyphens > 1 {
+		add("hyphens", float64(hyphens-1)/2, "%d hyphens", hyphens)
+	}
+
+	switch {
+	case d.Confusable != nil:
+		add("brand", 1, "homoglyph of %s", d.Confusable.Brand)
+	case d.Combo != nil:
+		add("brand", 0.9, "contains %s", d.Combo.Brand)
+	case d.BrandMatch != nil:
+		add("brand", (d.BrandMatch.Score-brandMinScore)/(100-brandMinScore),
+			"%.1f%% similar to %s", d.BrandMatch.Score, d.BrandMatch.Brand)
+	}
+
+	var hits []string
+	if d.Combo != nil {
+		hits = d.Combo.Lures
+	} else {
+		for _, lure := range lures {
+			// Short lures are found inside too many unrelated words
+			if len(lure) >= 4 && strings.Contains(label, lure) {
+				hits = append(hits, lure)
+			}
+		}
+	}
+	if len(hits) > 0 {
+		add("keywords", 0.6*float64(len(hits)), "lure words %s", strings.Join(hits, ", "))
+	}
+
+	if h := d.Health; h.IsOnline {
+		// A live site can do harm now, one serving pages most of all
+		switch {
+		case h.StatusCode >= 200 && h.StatusCode < 300:
+			add("health", 1, "online, HTTP %d", h.StatusCode)
+		case h.StatusCode != 0:
+			add("health", 0.5, "online, HTTP %d", h.StatusCode)
+		default:
+			add("health", 0.5, "online")
+		}
+	}
+
+	var whois []string
+	strength := 0.0
+	if l.Private {
+		strength += 0.5
+		whois = append(whois, "registrant hidden")
+	}
+	registrar := strings.ToLower(l.Registrar)
+	for _, r := range m.registrars {
+		if registrar != "" && strings.Contains(registrar, r) {
+			strength += 0.5
+			whois = append(whois, "registrar "+l.Registrar)
+			break
+		}
+	}
+	if strength > 0 {
+		add("whois", strength, "%s", strings.Join(whois, ", "))
+	}
+
+	for _, ns := range l.NameServers {
+		if provider := publicSuffixes.Registrable(ns); m.nameservers[provider] {
+			add("nameservers", 1, "DNS hosted by %s", provider)
+			break
+		}
+	}
+
+	r.Score = min(100, int(math.Round(total)))
+	return r
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+
+	h := 0.0
+	n := float64(len(s))
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+func riskScore(d *Domain) int {
+	if d.Risk == nil {
+		return 0
+	}
+	return d.Risk.Score
+}
+
+// rescoreRisk scores the named domain again after something it's scored on
+// changed. Callers must hold s.mu.
+func (s *Server) rescoreRisk(name string) {
+	if i, ok := s.index[name]; ok {
+		s.domains[i].Risk = riskScorer.assess(&s.domains[i], s.lookups[name])
+	}
+}
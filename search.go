@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchIndex maps byte trigrams of domain names to the positions of the
+// domains containing them, so substring and prefix searches only look at a
+// handful of candidates instead of scanning every domain. It is built once
+// per snapshot and never modified, and positions refer to that snapshot.
+type searchIndex struct {
+	grams map[uint32][]int32
+}
+
+// searchTerm is a substring (or prefix) every result must contain.
+type searchTerm struct {
+	text   string
+	prefix bool
+}
+
+// nameStart marks the start of a name so prefixes get their own trigrams.
+const nameStart = 0x01
+
+func trigram(a, b, c byte) uint32 {
+	return uint32(a)<<16 | uint32(b)<<8 | uint32(c)
+}
+
+func newSearchIndex(domains []Domain) *searchIndex {
+	idx := &searchIndex{grams: make(map[uint32][]int32)}
+
+	for i := range domains {
+		for _, name := range []string{domains[i].Name, domains[i].Unicode} {
+			if name == "" {
+				continue
+			}
+			text := string(rune(nameStart)) + name
+			for j := 0; j+3 <= len(text); j++ {
+				g := trigram(text[j], text[j+1], text[j+2])
+				// Postings are appended in order, so a repeated trigram
+				// within the same domain is always the last entry
+				list := idx.grams[g]
+				if len(list) > 0 && list[len(list)-1] == int32(i) {
+					continue
+				}
+				idx.grams[g] = append(list, int32(i))
+			}
+		}
+	}
+
+	return idx
+}
+
+// candidates returns the positions of domains that may satisfy every term,
+// in ascending order. ok is false when the terms are too short to use the
+// index and the caller has to scan.
+func (idx *searchIndex) candidates(terms []searchTerm) (positions []int32, ok bool) {
+	if idx == nil {
+		return nil, false
+	}
+
+	var lists [][]int32
+	for _, term := range terms {
+		text := term.text
+		if term.prefix {
+			text = string(rune(nameStart)) + text
+		}
+		for j := 0; j+3 <= len(text); j++ {
+			lists = append(lists, idx.grams[trigram(text[j], text[j+1], text[j+2])])
+		}
+	}
+	if len(lists) == 0 {
+		return nil, false
+	}
+
+	// Intersect starting from the rarest trigram so the working set stays small
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	positions = append([]int32(nil), lists[0]...)
+	for _, list := range lists[1:] {
+		if len(positions) == 0 {
+			break
+		}
+		positions = intersectSorted(positions, list)
+	}
+
+	return positions, true
+}
+
+// intersectSorted keeps the elements of a that are also in b, reusing a.
+func intersectSorted(a, b []int32) []int32 {
+	out := a[:0]
+	j := 0
+	for _, v := range a {
+		for j < len(b) && b[j] < v {
+			j++
+		}
+		if j == len(b) {
+			break
+		}
+		if b[j] == v {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// matchesTerms verifies a candidate, since sharing trigrams doesn't mean
+// the term actually occurs in the name.
+func matchesTerms(d *Domain, terms []searchTerm) bool {
+	for _, term := range terms {
+		if term.prefix {
+			if !strings.HasPrefix(d.Name, term.text) {
+				return false
+			}
+			continue
+		}
+		if !strings.Contains(d.Name, term.text) && !strings.Contains(d.Unicode, term.text) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchDomains returns the page of domains described by opts among those
+// that contain every term and satisfy match. Only positions are collected
+// while holding s.mu, and only the returned page is copied.
+func (s *Server) searchDomains(terms []searchTerm, match func(*Domain) bool, opts listOptions) listResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	less := func(a, b int32) bool {
+		c := compareDomains(&s.domains[a], &s.domains[b], opts.sort)
+		if opts.desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	var after *Domain
+	if opts.after != nil {
+		after = opts.after.domain()
+	}
+
+	// One extra so we know whether there is a next page
+	top := &topDomains{n: opts.offset + opts.limit + 1, less: less}
+	total := 0
+	truncated := false
+	var facets *Facets
+	if opts.facets {
+		facets = newFacets()
+	}
+	// visit reports whether to keep going, which stops once the deadline
+	// or the match cap is hit
+	visit := func(n int, i int32) bool {
+		if n%1024 == 0 && !opts.deadline.IsZero() && time.Now().After(opts.deadline) {
+			truncated = true
+			return false
+		}
+
+		d := &s.domains[i]
+		if !matchesTerms(d, terms) || !match(d) {
+			return true
+		}
+		total++
+		if facets != nil {
+			facets.add(d, s.lookups[d.Name].Registrar)
+		}
+		if opts.maxMatches > 0 && total >= opts.maxMatches {
+			truncated = true
+		}
+		if after != nil {
+			c := compareDomains(d, after, opts.sort)
+			if (!opts.desc && c <= 0) || (opts.desc && c >= 0) {
+				return !truncated
+			}
+		}
+		top.add(i)
+		return !truncated
+	}
+
+	if positions, ok := s.search.candidates(terms); ok {
+		for n, i := range positions {
+			if !visit(n, i) {
+				break
+			}
+		}
+	} else {
+		for n := range s.domains {
+			if !visit(n, int32(n)) {
+				break
+			}
+		}
+	}
+
+	res := listResult{
+		Domains:   make([]Domain, 0, opts.limit),
+		Total:     total,
+		Limit:     opts.limit,
+		Sort:      opts.sort,
+		Order:     "asc",
+		Version:   s.version,
+		Truncated: truncated,
+		Facets:    facets,
+	}
+	if opts.desc {
+		res.Order = "desc"
+	}
+	if opts.after != nil {
+		res.SnapshotChanged = opts.after.Version != s.version
+	}
+
+	positions := top.positions()
+	for k := opts.offset; k < len(positions) && len(res.Domains) < opts.limit; k++ {
+		res.Domains = append(res.Domains, s.domains[positions[k]])
+	}
+	if len(positions) > opts.offset+opts.limit {
+		res.NextCursor = encodeCursor(&res.Domains[len(res.Domains)-1], opts, s.version)
+	}
+
+	return res
+}
+
+// Limits for fuzzy and regex searches, which can't use the index and may be
+// slow per domain. They run under s.mu, so they must not be able to pin it.
+const (
+	searchTimeout    = 2 * time.Second
+	maxSearchMatches = 10000
+	maxFuzzyDistance = 3
+	maxRegexLength   = 256
+	maxRegexInsts    = 2000 // compiled program size
+)
+
+// searchFilter is the search parameter of /domains in one of its modes.
+type searchFilter struct {
+	terms     []searchTerm
+	match     func(*Domain) bool
+	expensive bool // subject to searchTimeout and maxSearchMatches
+}
+
+// parseSearch reads search, mode and distance:
+//
+//	mode=substring  names containing search (default)
+//	mode=fuzzy      names within distance edits of search, ignoring the TLD
+//	                unless search has one
+//	mode=regex      names matching search as an RE2 expression
+func parseSearch(query url.Values) (searchFilter, error) {
+	search := query.Get("search")
+	mode := query.Get("mode")
+	if search == "" {
+		if mode != "" && mode != "substring" {
+			return searchFilter{}, fmt.Errorf("mode=%s needs a search parameter", mode)
+		}
+		return searchFilter{match: func(*Domain) bool { return true }}, nil
+	}
+
+	switch mode {
+	case "", "substring":
+		return searchFilter{
+			terms: []searchTerm{{text: strings.ToLower(search)}},
+			match: func(*Domain) bool { return true },
+		}, nil
+
+	case "fuzzy":
+		distance := 1
+		if v := query.Get("distance"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > maxFuzzyDistance {
+				return searchFilter{}, fmt.Errorf("distance must be between 0 and %d", maxFuzzyDistance)
+			}
+			distance = n
+		}
+
+		target := strings.ToLower(search)
+		withTLD := strings.Contains(target, ".")
+		return searchFilter{
+			match: func(d *Domain) bool {
+				name := d.Name
+				if !withTLD {
+					name = nameLabel(d)
+				}
+				return levenshteinWithin(name, target, distance) <= distance
+			},
+			expensive: true,
+		}, nil
+
+	case "regex":
+		re, err := compileLimitedRegex(search)
+		if err != nil {
+			return searchFilter{}, err
+		}
+
+		f := searchFilter{
+			match: func(d *Domain) bool {
+				return re.MatchString(d.Name) || (d.Unicode != "" && re.MatchString(d.Unicode))
+			},
+			expensive: true,
+		}
+		// Every match contains the literal prefix, so the index can
+		// narrow things down when there is a long enough one
+		if prefix, _ := re.LiteralPrefix(); len(prefix) >= 3 {
+			f.terms = []searchTerm{{text: prefix}}
+		}
+		return f, nil
+	}
+
+	return searchFilter{}, fmt.Errorf("mode must be substring, fuzzy or regex")
+}
+
+// compileLimitedRegex compiles an RE2 expression from a user, rejecting ones
+// longer than maxRegexLength or compiling to more than maxRegexInsts.
+func compileLimitedRegex(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > maxRegexLength {
+		return nil, fmt.Errorf("regex longer than %d characters", maxRegexLength)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil || len(prog.Inst) > maxRegexInsts {
+		return nil, fmt.Errorf("regex too complex")
+	}
+	return regexp.Compile(pattern)
+}
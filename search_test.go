@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// benchDomainCount is the size of the synthetic feed, a few million names
+// like the one the index is meant for.
+const benchDomainCount = 3_000_000
+
+var (
+	benchOnce    sync.Once
+	benchDomains []Domain
+	benchIndex   *searchIndex
+)
+
+// benchFeed returns a deterministic feed of made-up names, built from a small
+// vocabulary so common words match a large share of it, and its index.
+func benchFeed() ([]Domain, *searchIndex) {
+	benchOnce.Do(func() {
+		words := []string{
+			"shop", "online", "best", "cloud", "secure", "app", "my", "the", "web", "digital",
+			"green", "home", "tech", "store", "global", "bank", "pay", "travel", "smart", "data",
+		}
+		tlds := []string{"com", "net", "org", "xyz", "shop", "online", "co.uk", "de"}
+
+		rng := rand.New(rand.NewSource(1))
+		benchDomains = make([]Domain, benchDomainCount)
+		for i := range benchDomains {
+			name := fmt.Sprintf("%s%s%d.%s",
+				words[rng.Intn(len(words))], words[rng.Intn(len(words))], rng.Intn(100000), tlds[rng.Intn(len(tlds))])
+			benchDomains[i] = Domain{Name: name, TLD: tlds[i%len(tlds)]}
+		}
+		benchIndex = newSearchIndex(benchDomains)
+	})
+	return benchDomains, benchIndex
+}
+
+// BenchmarkSearch compares answering /domains searches from the trigram
+// index with scanning every domain, which is what happens without one.
+func BenchmarkSearch(b *testing.B) {
+	domains, idx := benchFeed()
+
+	queries := []struct {
+		name  string
+		terms []searchTerm
+	}{
+		{"rare", []searchTerm{{text: "shopbank4242"}}},
+		{"prefix", []searchTerm{{text: "travel", prefix: true}}},
+		{"common", []searchTerm{{text: "cloud"}}},
+	}
+	opts := listOptions{sort: "name", limit: 50}
+	all := func(*Domain) bool { return true }
+
+	for _, q := range queries {
+		for _, mode := range []string{"scan", "index"} {
+			s := &Server{domains: domains}
+			if mode == "index" {
+				s.search = idx
+			}
+			b.Run(q.name+"/"+mode, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					s.searchDomains(q.terms, all, opts)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkSearchIndexBuild(b *testing.B) {
+	domains, _ := benchFeed()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newSearchIndex(domains)
+	}
+}
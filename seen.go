@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+)
+
+// seenRetention is how long a domain that left every feed is remembered, so
+// a domain that reappears within that time keeps its original first-seen.
+const seenRetention = 90 * 24 * time.Hour
+
+// seenRecord tracks when a domain was first and last reported by any feed.
+type seenRecord struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// markSeen updates the first/last seen times of every domain in the new
+// snapshot and forgets domains that have been gone longer than
+// seenRetention. Callers must hold s.mu.
+func (s *Server) markSeen(domains []Domain, now time.Time) {
+	for i := range domains {
+		d := &domains[i]
+		rec, ok := s.seen[d.Name]
+		if !ok {
+			rec.FirstSeen = now
+		}
+		rec.LastSeen = now
+		s.seen[d.Name] = rec
+
+		d.FirstSeen = rec.FirstSeen
+		d.LastSeen = rec.LastSeen
+		d.CreatedAt = rec.FirstSeen
+	}
+
+	cutoff := now.Add(-seenRetention)
+	for name, rec := range s.seen {
+		if rec.LastSeen.Before(cutoff) {
+			delete(s.seen, name)
+		}
+	}
+}
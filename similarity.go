@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// similarityThresholds are the thresholds there are upstream files for.
+var similarityThresholds = map[string]bool{"70": true, "80": true, "90": true, "100": true}
+
+// similarityLine is a line of an upstream file, "new.com -> brand.com (87.5%)".
+var similarityLine = regexp.MustCompile(`(.*?) -> (.*?) \(([\d.]+)%\)`)
+
+// SimilarityData summarizes the lookalikes of a target domain.
+type SimilarityData struct {
+	TargetDomain string   `json:"targetDomain"`
+	Count        int      `json:"count"`
+	Examples     []string `json:"examples"` // the three most similar
+	Similarity   float64  `json:"similarity"`
+}
+
+type SimilarityResponse struct {
+	Data  []SimilarityData `json:"data"`
+	Total int              `json:"total"`
+	Page  int              `json:"page"`
+	Limit int              `json:"limit"`
+	Sort  string           `json:"sort"`
+	Order string           `json:"order"`
+}
+
+// Lookalike is a domain resembling a target, with what the feed knows
+// about it.
+type Lookalike struct {
+	Domain     string        `json:"domain"`
+	Similarity float64       `json:"similarity"`
+	InFeed     bool          `json:"in_feed"`
+	FirstSeen  *time.Time    `json:"first_seen,omitempty"`
+	Health     *DomainHealth `json:"health,omitempty"`
+}
+
+// CachedData is everything known at a threshold: a summary per target, most
+// lookalikes first, and every lookalike of each target.
+type CachedData struct {
+	Data       []SimilarityData
+	Lookalikes map[string][]Lookalike `json:",omitempty"` // by target, most similar first
+	Timestamp  time.Time
+}
+
+// newCachedData sorts lookalikes and summarizes them.
+func newCachedData(lookalikes map[string][]Lookalike) *CachedData {
+	data := &CachedData{
+		Data:       make([]SimilarityData, 0, len(lookalikes)),
+		Lookalikes: lookalikes,
+		Timestamp:  time.Now(),
+	}
+
+	for target, list := range lookalikes {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Similarity != list[j].Similarity {
+				return list[i].Similarity > list[j].Similarity
+			}
+			return list[i].Domain < list[j].Domain
+		})
+
+		summary := SimilarityData{
+			TargetDomain: target,
+			Count:        len(list),
+			Examples:     make([]string, 0, 3),
+			Similarity:   list[0].Similarity,
+		}
+		for _, l := range list[:min(3, len(list))] {
+			summary.Examples = append(summary.Examples, l.Domain)
+		}
+		data.Data = append(data.Data, summary)
+	}
+
+	sort.Slice(data.Data, func(i, j int) bool {
+		if data.Data[i].Count != data.Data[j].Count {
+			return data.Data[i].Count > data.Data[j].Count
+		}
+		return data.Data[i].TargetDomain < data.Data[j].TargetDomain
+	})
+	return data
+}
+
+// handleSimilarity lists the targets with lookalikes at a threshold, by
+// default those with the most first, 10 per page. sort can be count,
+// similarity or target.
+func (s *Server) handleSimilarity(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = "count"
+	}
+	if sortBy != "count" && sortBy != "similarity" && sortBy != "target" {
+		http.Error(w, fmt.Sprintf("invalid sort %q", sortBy), http.StatusBadRequest)
+		return
+	}
+	desc, err := parseOrder(query, sortBy != "target")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, page := parsePage(query, 10, 100)
+
+	cached, ok := s.loadSimilarity(w, r)
+	if !ok {
+		return
+	}
+
+	targets := append([]SimilarityData(nil), cached.Data...)
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i], targets[j]
+		var c int
+		switch sortBy {
+		case "count":
+			c = cmp.Compare(a.Count, b.Count)
+		case "similarity":
+			c = cmp.Compare(a.Similarity, b.Similarity)
+		case "target":
+			c = strings.Compare(a.TargetDomain, b.TargetDomain)
+		}
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			return a.TargetDomain < b.TargetDomain
+		}
+		return c < 0
+	})
+
+	start := min((page-1)*limit, len(targets))
+	end := min(start+limit, len(targets))
+	response := SimilarityResponse{
+		Data:  targets[start:end],
+		Total: len(targets),
+		Page:  page,
+		Limit: limit,
+		Sort:  sortBy,
+		Order: orderName(desc),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// handleSimilarityTarget lists every lookalike of a target at a threshold,
+// most similar first, with its first-seen time and health if it's in the
+// feed.
+func (s *Server) handleSimilarityTarget(w http.ResponseWriter, r *http.Request) {
+	target := strings.ToLower(chi.URLParam(r, "target"))
+	limit, page := parsePage(r.URL.Query(), 100, 1000)
+
+	cached, ok := s.loadSimilarity(w, r)
+	if !ok {
+		return
+	}
+
+	all, ok := cached.Lookalikes[target]
+	if !ok {
+		http.Error(w, "no lookalikes of "+target+" at this threshold", http.StatusNotFound)
+		return
+	}
+
+	start := min((page-1)*limit, len(all))
+	list := append([]Lookalike(nil), all[start:min(start+limit, len(all))]...)
+
+	s.mu.RLock()
+	for i := range list {
+		if j, ok := s.index[list[i].Domain]; ok {
+			d := s.domains[j]
+			list[i].InFeed = true
+			list[i].FirstSeen = &d.FirstSeen
+			list[i].Health = &d.Health
+		}
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"target":     target,
+		"threshold":  chi.URLParam(r, "threshold"),
+		"total":      len(all),
+		"page":       page,
+		"limit":      limit,
+		"lookalikes": list,
+	})
+}
+
+// loadSimilarity returns the lookalikes at the request's threshold, writing
+// an error response if there are none. With a brand list they are computed
+// locally, at any threshold, otherwise they come from the precomputed
+// Fortune 500 files.
+func (s *Server) loadSimilarity(w http.ResponseWriter, r *http.Request) (*CachedData, bool) {
+	threshold := chi.URLParam(r, "threshold")
+
+	if len(s.brands) > 0 {
+		value, err := parseThreshold(threshold)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+		return s.brandSimilarity(value), true
+	}
+
+	if !similarityThresholds[threshold] {
+		http.Error(w, "threshold must be one of 70, 80, 90 or 100", http.StatusBadRequest)
+		return nil, false
+	}
+	cached, err := s.fetchAndCacheSimilarityData(threshold)
+	if err != nil {
+		log.Printf("Error fetching similarity data: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	return cached, true
+}
+
+// parsePage reads limit and page, falling back to the defaults for missing
+// or out of range values like parseListOptions does.
+func parsePage(query url.Values, defaultLimit, maxLimit int) (limit, page int) {
+	limit, _ = strconv.Atoi(query.Get("limit"))
+	if limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+	page, _ = strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	return limit, page
+}
+
+func parseOrder(query url.Values, defaultDesc bool) (bool, error) {
+	switch query.Get("order") {
+	case "":
+		return defaultDesc, nil
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	}
+	return false, fmt.Errorf("order must be asc or desc")
+}
+
+func orderName(desc bool) string {
+	if desc {
+		return "desc"
+	}
+	return "asc"
+}
+
+func (s *Server) fetchAndCacheSimilarityData(threshold string) (*CachedData, error) {
+	s.similarityMu.RLock()
+	// Data cached before every lookalike was kept, e.g. from an old
+	// snapshot, is fetched again
+	if cached, ok := s.similarityCache[threshold]; ok && cached.Lookalikes != nil {
+		if time.Since(cached.Timestamp) < time.Hour {
+			s.similarityMu.RUnlock()
+			return cached, nil
+		}
+	}
+	s.similarityMu.RUnlock()
+
+	log.Printf("Fetching similarity data for threshold: %s", threshold)
+
+	// Create a custom HTTP client with timeout and proper headers
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:       10,
+			IdleConnTimeout:    30 * time.Second,
+			DisableCompression: true,
+		},
+	}
+
+	// threshold is one of similarityThresholds, never user input
+	url := "https://codeberg.org/webamon/newly_registered_domains/raw/branch/main/monitoring_output/f500_domains/similarity_" + threshold + ".txt"
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	// Add necessary headers
+	req.Header.Set("User-Agent", "DomainSentinel/1.0")
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch similarity data: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	lookalikes := make(map[string][]Lookalike)
+	seen := make(map[[2]string]bool)
+
+	for scanner.Scan() {
+		match := similarityLine.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		newDomain := strings.ToLower(strings.TrimSpace(match[1]))
+		targetDomain := strings.ToLower(strings.TrimSpace(match[2]))
+		similarity, _ := strconv.ParseFloat(match[3], 64)
+
+		key := [2]string{targetDomain, newDomain}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		lookalikes[targetDomain] = append(lookalikes[targetDomain], Lookalike{Domain: newDomain, Similarity: similarity})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+
+	if len(lookalikes) == 0 {
+		return nil, fmt.Errorf("no similarity data found")
+	}
+
+	result := newCachedData(lookalikes)
+
+	s.similarityMu.Lock()
+	s.similarityCache[threshold] = result
+	s.similarityMu.Unlock()
+
+	return result, nil
+}
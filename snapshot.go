@@ -0,0 +1,207 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes in a way
+// older readers can't handle.
+const snapshotVersion = 1
+
+// Snapshot is a portable copy of everything a server knows, written as
+// gzip'd JSON.
+type Snapshot struct {
+	Version    int                        `json:"version"`
+	CreatedAt  time.Time                  `json:"created_at"`
+	LastUpdate time.Time                  `json:"last_update"`
+	Stats      DomainStats                `json:"stats"`
+	Domains    []Domain                   `json:"domains"`
+	Removed    []RemovedDomain            `json:"removed"`
+	Seen       map[string]seenRecord      `json:"seen"`
+	Lookups    map[string]json.RawMessage `json:"lookups"` // whois:NAME and dns:NAME results
+	Similarity map[string]*CachedData     `json:"similarity"`
+}
+
+func (s *Server) buildSnapshot() (*Snapshot, error) {
+	snap := &Snapshot{
+		Version:    snapshotVersion,
+		CreatedAt:  time.Now(),
+		Lookups:    make(map[string]json.RawMessage),
+		Similarity: make(map[string]*CachedData),
+	}
+
+	// Stored lookups first so fresher in-memory ones win
+	err := s.store.ForEachLookup(func(key string, value json.RawMessage) error {
+		snap.Lookups[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range s.cache.Items() {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		snap.Lookups[key] = data
+	}
+
+	s.similarityMu.RLock()
+	for threshold, data := range s.similarityCache {
+		snap.Similarity[threshold] = data
+	}
+	s.similarityMu.RUnlock()
+
+	// Copied under the lock, since the snapshot is encoded after it's
+	// released while fetches and health checks keep changing these
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap.LastUpdate = s.lastUpdate
+	snap.Stats = s.stats
+	snap.Domains = slices.Clone(s.domains)
+	snap.Removed = slices.Clone(s.removed)
+	snap.Seen = maps.Clone(s.seen)
+
+	return snap, nil
+}
+
+func writeSnapshot(w io.Writer, snap *Snapshot) error {
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(snap); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+func readSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var snap Snapshot
+	if err := json.NewDecoder(gz).Decode(&snap); err != nil {
+		return nil, err
+	}
+	if snap.Version < 1 || snap.Version > snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+	return &snap, nil
+}
+
+// exportSnapshot writes the current state to path, going through a
+// temporary file so a failed export doesn't leave a truncated snapshot.
+func (s *Server) exportSnapshot(path string) error {
+	snap, err := s.buildSnapshot()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := writeSnapshot(f, snap); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restoreSnapshot replaces the server state with a snapshot and writes it
+// through to the store.
+func (s *Server) restoreSnapshot(snap *Snapshot) error {
+	for key, raw := range snap.Lookups {
+		var value interface{}
+		switch {
+		case strings.HasPrefix(key, "whois:"):
+			value = &WhoisInfo{}
+		case strings.HasPrefix(key, "dns:"):
+			value = &DNSInfo{}
+		default:
+			continue
+		}
+		if err := json.Unmarshal(raw, value); err != nil {
+			return fmt.Errorf("lookup %s: %v", key, err)
+		}
+		s.cache.Set(key, value)
+		switch info := value.(type) {
+		case *WhoisInfo:
+			s.noteWhois(info)
+		case *DNSInfo:
+			s.noteDNS(info)
+		}
+		if err := s.store.PutLookup(key, value); err != nil {
+			return err
+		}
+	}
+
+	s.similarityMu.Lock()
+	for threshold, data := range snap.Similarity {
+		s.similarityCache[threshold] = data
+	}
+	s.similarityMu.Unlock()
+
+	if snap.Seen == nil {
+		snap.Seen = make(map[string]seenRecord)
+	}
+
+	s.mu.Lock()
+	s.domains = snap.Domains
+	s.index = make(map[string]int, len(snap.Domains))
+	s.search = newSearchIndex(snap.Domains)
+	s.version++
+	for i, d := range snap.Domains {
+		s.index[d.Name] = i
+	}
+	s.removed = snap.Removed
+	s.seen = snap.Seen
+	s.lastUpdate = snap.LastUpdate
+	s.stats = snap.Stats
+	s.mu.Unlock()
+
+	log.Printf("Restored %d domains from a snapshot taken %s", len(snap.Domains), snap.CreatedAt.Format(time.RFC3339))
+
+	return s.store.SaveState(s.storedState())
+}
+
+func (s *Server) handleSnapshotExport(w http.ResponseWriter, r *http.Request) {
+	snap, err := s.buildSnapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("domainmon-%s.json.gz", snap.CreatedAt.UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	if err := writeSnapshot(w, snap); err != nil {
+		log.Printf("Error writing snapshot: %v", err)
+	}
+}
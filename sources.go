@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultFeedURL = "https://codeberg.org/webamon/newly_registered_domains/raw/branch/main/new_domains.txt"
+
+// FeedSource is anything that can produce a newline separated list of domains.
+type FeedSource interface {
+	Name() string
+	Open() (io.ReadCloser, error)
+}
+
+// watcher is implemented by sources that can signal a change between
+// scheduled fetches.
+type watcher interface {
+	Watch(notify chan<- struct{})
+}
+
+// dropReporter is implemented by sources that know which domains were
+// deleted, rather than leaving it to the snapshot diff.
+type dropReporter interface {
+	Dropped() []string
+}
+
+// windowSource is implemented by sources that only report domains seen
+// within a recent window, so a domain that ages out of one, or that it lost
+// track of on restart, wasn't deleted.
+type windowSource interface {
+	Window() time.Duration
+}
+
+// certTimestamper is implemented by sources that know when a certificate
+// for a domain was logged.
+type certTimestamper interface {
+	CertTimestamp(domain string) (time.Time, bool)
+}
+
+// ParseSource builds a FeedSource from a command line spec:
+//
+//	https://host/path   HTTP(S) URL
+//	file:/path/to/list  local file
+//	dir:/path/to/dir    every file in a directory, re-read when it changes
+//	zone:/path/to/dir   consecutive CZDS zone file snapshots of one zone
+//	ct:https://log/     an RFC 6962 Certificate Transparency log
+//	-                   standard input, read once
+func ParseSource(spec string) (FeedSource, error) {
+	switch {
+	case spec == "-" || spec == "stdin":
+		return &stdinSource{}, nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return &httpSource{url: spec}, nil
+	case strings.HasPrefix(spec, "file:"):
+		return &fileSource{path: strings.TrimPrefix(spec, "file:")}, nil
+	case strings.HasPrefix(spec, "dir:"):
+		return &dirSource{path: strings.TrimPrefix(spec, "dir:")}, nil
+	case strings.HasPrefix(spec, "ct:"):
+		return newCTSource(strings.TrimPrefix(spec, "ct:")), nil
+	case strings.HasPrefix(spec, "zone:"):
+		return &zoneSource{dirSource: dirSource{path: strings.TrimPrefix(spec, "zone:")}}, nil
+	}
+
+	info, err := os.Stat(spec)
+	if err != nil {
+		return nil, fmt.Errorf("unknown feed source %q", spec)
+	}
+	if info.IsDir() {
+		return &dirSource{path: spec}, nil
+	}
+	return &fileSource{path: spec}, nil
+}
+
+// sourceFlags collects repeated -source flags.
+type sourceFlags []string
+
+func (f *sourceFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *sourceFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// errNotModified is returned by sources whose content hasn't changed since
+// the last successful fetch.
+var errNotModified = errors.New("not modified")
+
+type httpSource struct {
+	url string
+
+	// Validators from the last complete download
+	etag         string
+	lastModified string
+}
+
+func (h *httpSource) Name() string {
+	return h.url
+}
+
+// feedClient has a generous timeout since it covers reading the whole body
+var feedClient = &http.Client{
+	Timeout: 10 * time.Minute,
+}
+
+func (h *httpSource) Open() (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "DomainSentinel/1.0")
+	req.Header.Set("Accept", "text/plain")
+	if h.etag != "" {
+		req.Header.Set("If-None-Match", h.etag)
+	}
+	if h.lastModified != "" {
+		req.Header.Set("If-Modified-Since", h.lastModified)
+	}
+
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, errNotModified
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &statusError{code: resp.StatusCode}
+	}
+	if ct := resp.Header.Get("Content-Type"); !plainTextType(ct) {
+		resp.Body.Close()
+		return nil, &permanentError{fmt.Errorf("unexpected content type %q", ct)}
+	}
+
+	// Only remember the validators once the body has been read in full,
+	// otherwise a failed download would be answered with 304 next time
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return &eofHook{ReadCloser: resp.Body, onEOF: func() {
+		h.etag, h.lastModified = etag, lastModified
+	}}, nil
+}
+
+// eofHook calls onEOF once the wrapped reader has been read to the end.
+type eofHook struct {
+	io.ReadCloser
+	onEOF func()
+}
+
+func (e *eofHook) Read(p []byte) (int, error) {
+	n, err := e.ReadCloser.Read(p)
+	if err == io.EOF && e.onEOF != nil {
+		e.onEOF()
+		e.onEOF = nil
+	}
+	return n, err
+}
+
+// plainTextType reports whether a Content-Type can hold a domain list. Error
+// pages are usually served as HTML, which is what this mostly guards against.
+func plainTextType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/html", mediaType == "application/xhtml+xml":
+		return false
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/octet-stream":
+		return true
+	}
+	return false
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.code)
+}
+
+// permanentError wraps errors that won't go away by retrying.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// retryable reports whether a failed fetch is worth trying again. Client
+// errors other than timeouts and rate limiting are not.
+func retryable(err error) bool {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return false
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		switch {
+		case se.code == http.StatusRequestTimeout, se.code == http.StatusTooManyRequests:
+			return true
+		case se.code >= 400 && se.code < 500:
+			return false
+		}
+	}
+
+	return !os.IsNotExist(err)
+}
+
+type fileSource struct {
+	path string
+}
+
+func (f *fileSource) Name() string {
+	return "file:" + f.path
+}
+
+func (f *fileSource) Open() (io.ReadCloser, error) {
+	return os.Open(f.path)
+}
+
+type dirSource struct {
+	path string
+}
+
+func (d *dirSource) Name() string {
+	return "dir:" + d.path
+}
+
+func (d *dirSource) files() ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(d.path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+	return files, nil
+}
+
+func (d *dirSource) Open() (io.ReadCloser, error) {
+	files, err := d.files()
+	if err != nil {
+		return nil, err
+	}
+
+	mr := &multiReadCloser{}
+	readers := make([]io.Reader, 0, len(files)*2)
+	for _, info := range files {
+		f, err := os.Open(filepath.Join(d.path, info.Name()))
+		if err != nil {
+			mr.Close()
+			return nil, err
+		}
+		mr.closers = append(mr.closers, f)
+		// Files are not guaranteed to end in a newline
+		readers = append(readers, f, strings.NewReader("\n"))
+	}
+	mr.Reader = io.MultiReader(readers...)
+
+	return mr, nil
+}
+
+// Watch polls the directory and notifies when files are added, removed or
+// modified so new drops are picked up without waiting for the next fetch.
+func (d *dirSource) Watch(notify chan<- struct{}) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	last := d.signature()
+	for range ticker.C {
+		sig := d.signature()
+		if sig == last {
+			continue
+		}
+		last = sig
+
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *dirSource) signature() string {
+	files, err := d.files()
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, info := range files {
+		fmt.Fprintf(&b, "%s:%d:%d;", info.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
+
+type multiReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiReadCloser) Close() error {
+	var first error
+	for _, c := range m.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// stdinSource reads standard input once and replays it on every fetch.
+type stdinSource struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+func (st *stdinSource) Name() string {
+	return "stdin"
+}
+
+func (st *stdinSource) Open() (io.ReadCloser, error) {
+	st.once.Do(func() {
+		st.data, st.err = io.ReadAll(os.Stdin)
+	})
+	if st.err != nil {
+		return nil, st.err
+	}
+	return io.NopCloser(bytes.NewReader(st.data)), nil
+}
@@ -5,6 +5,7 @@ func (s *Server) updateStats() {
 		TotalDomains:   len(s.domains),
 		DomainsPerTLD:  make(map[string]int),
 		LastUpdateTime: s.lastUpdate,
+		UnchangedSince: s.lastUpdate,
 	}
 
 	for _, domain := range s.domains {
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// lookupTTL is how long stored WHOIS and DNS results are served before
+// they are looked up again.
+const lookupTTL = 7 * 24 * time.Hour
+
+// Store persists the state that is expensive to rebuild, so a restart
+// doesn't lose history or re-query upstreams.
+type Store interface {
+	LoadState() (*StoredState, error)
+	SaveState(state *StoredState) error
+	RecordHealth(checkedAt time.Time, health map[string]DomainHealth) error
+	HealthHistory(domain string) ([]HealthRecord, error)
+	GetLookup(key string, v interface{}) (bool, error)
+	PutLookup(key string, v interface{}) error
+	ForEachLookup(fn func(key string, value json.RawMessage) error) error
+	Watchlists() ([]Watchlist, error)
+	SaveWatchlist(w *Watchlist) error
+	DeleteWatchlist(id string) error // along with its matches
+	AddWatchMatches(id string, matches []WatchMatch) error
+	WatchMatches(id string, since, until time.Time) ([]WatchMatch, error)
+	Close() error
+}
+
+// StoredState is the domain snapshot and the bookkeeping needed to keep
+// diffing against it after a restart.
+type StoredState struct {
+	Domains    []Domain
+	Removed    []RemovedDomain
+	Seen       map[string]seenRecord
+	LastUpdate time.Time
+}
+
+// loadState restores the last saved snapshot so the first fetch after a
+// restart is diffed against it rather than against nothing.
+func (s *Server) loadState() error {
+	state, err := s.store.LoadState()
+	if err != nil {
+		return err
+	}
+	lookups, err := s.loadLookups()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lookups = lookups
+
+	s.domains = state.Domains
+	s.index = make(map[string]int, len(state.Domains))
+	s.search = newSearchIndex(state.Domains)
+	s.version++
+	for i, d := range state.Domains {
+		s.index[d.Name] = i
+	}
+	s.removed = state.Removed
+	s.seen = state.Seen
+	s.lastUpdate = state.LastUpdate
+	s.updateStats()
+
+	if len(s.domains) > 0 {
+		log.Printf("Loaded %d domains from the store", len(s.domains))
+	}
+	return nil
+}
+
+// storedState copies the state to save. It's written after s.mu is released,
+// so a slow disk doesn't hold up readers and the health updater.
+func (s *Server) storedState() *StoredState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &StoredState{
+		Domains:    slices.Clone(s.domains),
+		Removed:    slices.Clone(s.removed),
+		Seen:       maps.Clone(s.seen),
+		LastUpdate: s.lastUpdate,
+	}
+}
+
+// memoryStore is used without -db. The snapshot and lookups already live in
+// Server and Cache, so it only keeps what has no other home: health history
+// and watchlists.
+type memoryStore struct {
+	mu         sync.Mutex
+	history    map[string][]HealthRecord
+	watchlists map[string]Watchlist
+	matches    map[string][]WatchMatch // by watchlist, oldest first
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		history:    make(map[string][]HealthRecord),
+		watchlists: make(map[string]Watchlist),
+		matches:    make(map[string][]WatchMatch),
+	}
+}
+
+func (m *memoryStore) LoadState() (*StoredState, error) {
+	return &StoredState{Seen: make(map[string]seenRecord)}, nil
+}
+func (m *memoryStore) SaveState(*StoredState) error                { return nil }
+func (m *memoryStore) GetLookup(string, interface{}) (bool, error) { return false, nil }
+func (m *memoryStore) PutLookup(string, interface{}) error         { return nil }
+func (m *memoryStore) ForEachLookup(func(string, json.RawMessage) error) error {
+	return nil
+}
+func (m *memoryStore) Close() error { return nil }
+
+func (m *memoryStore) RecordHealth(checkedAt time.Time, health map[string]DomainHealth) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := checkedAt.Add(-historyRetention)
+	for name, h := range health {
+		records := m.history[name]
+		i := sort.Search(len(records), func(i int) bool {
+			return records[i].CheckedAt.After(cutoff)
+		})
+		m.history[name] = append(records[i:], HealthRecord{CheckedAt: checkedAt, DomainHealth: h})
+	}
+	return nil
+}
+
+func (m *memoryStore) HealthHistory(domain string) ([]HealthRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]HealthRecord(nil), m.history[domain]...), nil
+}
+
+func (m *memoryStore) Watchlists() ([]Watchlist, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Watchlist, 0, len(m.watchlists))
+	for _, w := range m.watchlists {
+		list = append(list, w)
+	}
+	return list, nil
+}
+
+func (m *memoryStore) SaveWatchlist(w *Watchlist) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.watchlists[w.ID] = *w
+	return nil
+}
+
+func (m *memoryStore) DeleteWatchlist(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.watchlists, id)
+	delete(m.matches, id)
+	return nil
+}
+
+func (m *memoryStore) AddWatchMatches(id string, matches []WatchMatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := time.Now().Add(-watchMatchRetention)
+	records := m.matches[id]
+	i := sort.Search(len(records), func(i int) bool {
+		return records[i].MatchedAt.After(cutoff)
+	})
+	m.matches[id] = append(records[i:], matches...)
+	return nil
+}
+
+func (m *memoryStore) WatchMatches(id string, since, until time.Time) ([]WatchMatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matches []WatchMatch
+	for _, match := range m.matches[id] {
+		if inRange(match.MatchedAt, since, until) {
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
+
+var (
+	bucketDomains = []byte("domains")
+	bucketHealth  = []byte("health")
+	bucketHistory = []byte("history")
+	bucketRemoved = []byte("removed")
+	bucketSeen    = []byte("seen")
+	bucketLookups = []byte("lookups")
+	bucketMeta    = []byte("meta")
+
+	bucketWatchlists   = []byte("watchlists")
+	bucketWatchMatches = []byte("watchmatches")
+)
+
+// boltStore is a Store backed by a single bbolt file.
+type boltStore struct {
+	db *bolt.DB
+}
+
+func OpenBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketDomains, bucketHealth, bucketHistory, bucketRemoved, bucketSeen, bucketLookups, bucketMeta, bucketWatchlists, bucketWatchMatches} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func (b *boltStore) LoadState() (*StoredState, error) {
+	state := &StoredState{Seen: make(map[string]seenRecord)}
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		health := tx.Bucket(bucketHealth)
+		err := tx.Bucket(bucketDomains).ForEach(func(k, v []byte) error {
+			var d Domain
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if h := health.Get(k); h != nil {
+				json.Unmarshal(h, &d.Health)
+			}
+			state.Domains = append(state.Domains, d)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(bucketRemoved).ForEach(func(k, v []byte) error {
+			var d RemovedDomain
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			state.Removed = append(state.Removed, d)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(bucketSeen).ForEach(func(k, v []byte) error {
+			var rec seenRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			state.Seen[string(k)] = rec
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if v := tx.Bucket(bucketMeta).Get([]byte("last_update")); v != nil {
+			return state.LastUpdate.UnmarshalText(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// SaveState replaces the stored snapshot. Health is stored separately by
+// RecordHealth so it is left out of the domain records.
+func (b *boltStore) SaveState(state *StoredState) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		domains, err := recreateBucket(tx, bucketDomains)
+		if err != nil {
+			return err
+		}
+		for _, d := range state.Domains {
+			d.Health = DomainHealth{}
+			if err := putJSON(domains, d.Name, d); err != nil {
+				return err
+			}
+		}
+
+		// Drop health for domains that are no longer in the snapshot
+		health := tx.Bucket(bucketHealth)
+		var stale [][]byte
+		health.ForEach(func(k, _ []byte) error {
+			if domains.Get(k) == nil {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range stale {
+			if err := health.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		removed, err := recreateBucket(tx, bucketRemoved)
+		if err != nil {
+			return err
+		}
+		for _, d := range state.Removed {
+			// Keyed by time so ForEach returns them in removal order
+			key := d.RemovedAt.UTC().Format(time.RFC3339Nano) + " " + d.Name
+			if err := putJSON(removed, key, d); err != nil {
+				return err
+			}
+		}
+
+		seen, err := recreateBucket(tx, bucketSeen)
+		if err != nil {
+			return err
+		}
+		for name, rec := range state.Seen {
+			if err := putJSON(seen, name, rec); err != nil {
+				return err
+			}
+		}
+
+		lastUpdate, err := state.LastUpdate.MarshalText()
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketMeta).Put([]byte("last_update"), lastUpdate)
+	})
+}
+
+// RecordHealth stores the latest result per domain and appends it to the
+// domain's history, pruning records older than historyRetention.
+func (b *boltStore) RecordHealth(checkedAt time.Time, health map[string]DomainHealth) error {
+	cutoff := checkedAt.Add(-historyRetention).UTC().Format(historyTimeFormat)
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		latest := tx.Bucket(bucketHealth)
+		history := tx.Bucket(bucketHistory)
+
+		for name, h := range health {
+			if err := putJSON(latest, name, h); err != nil {
+				return err
+			}
+
+			// History keys sort by domain, then time, so expired
+			// records are the first ones under the domain's prefix
+			prefix := []byte(name + " ")
+			var expired [][]byte
+			c := history.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				if string(k[len(prefix):]) >= cutoff {
+					break
+				}
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			for _, k := range expired {
+				if err := history.Delete(k); err != nil {
+					return err
+				}
+			}
+
+			if err := putJSON(history, string(historyKey(name, checkedAt)), h); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) HealthHistory(domain string) ([]HealthRecord, error) {
+	var records []HealthRecord
+	prefix := []byte(domain + " ")
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketHistory).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var rec HealthRecord
+			if err := json.Unmarshal(v, &rec.DomainHealth); err != nil {
+				return err
+			}
+			t, err := time.Parse(historyTimeFormat, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			rec.CheckedAt = t
+			records = append(records, rec)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// historyTimeFormat has a fixed width so keys sort chronologically.
+const historyTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+func historyKey(domain string, t time.Time) []byte {
+	return []byte(domain + " " + t.UTC().Format(historyTimeFormat))
+}
+
+type storedLookup struct {
+	StoredAt time.Time       `json:"stored_at"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// GetLookup decodes a stored WHOIS/DNS result into v if there is one younger
+// than lookupTTL.
+func (b *boltStore) GetLookup(key string, v interface{}) (bool, error) {
+	var raw []byte
+	b.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(bucketLookups).Get([]byte(key)); data != nil {
+			raw = append(raw, data...)
+		}
+		return nil
+	})
+	if raw == nil {
+		return false, nil
+	}
+
+	var stored storedLookup
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return false, err
+	}
+	if time.Since(stored.StoredAt) > lookupTTL {
+		return false, nil
+	}
+	return true, json.Unmarshal(stored.Value, v)
+}
+
+func (b *boltStore) PutLookup(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketLookups), key, storedLookup{StoredAt: time.Now(), Value: value})
+	})
+}
+
+// ForEachLookup calls fn with every stored lookup that hasn't expired.
+func (b *boltStore) ForEachLookup(fn func(key string, value json.RawMessage) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketLookups).ForEach(func(k, v []byte) error {
+			var stored storedLookup
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+			if time.Since(stored.StoredAt) > lookupTTL {
+				return nil
+			}
+			return fn(string(k), append(json.RawMessage(nil), stored.Value...))
+		})
+	})
+}
+
+func (b *boltStore) Watchlists() ([]Watchlist, error) {
+	var list []Watchlist
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketWatchlists).ForEach(func(k, v []byte) error {
+			var w Watchlist
+			if err := json.Unmarshal(v, &w); err != nil {
+				return err
+			}
+			list = append(list, w)
+			return nil
+		})
+	})
+	return list, err
+}
+
+func (b *boltStore) SaveWatchlist(w *Watchlist) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketWatchlists), w.ID, w)
+	})
+}
+
+func (b *boltStore) DeleteWatchlist(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketWatchlists).Delete([]byte(id)); err != nil {
+			return err
+		}
+		return deletePrefix(tx.Bucket(bucketWatchMatches), []byte(id+" "), "")
+	})
+}
+
+// AddWatchMatches stores matches keyed by watchlist, then time, pruning
+// those older than watchMatchRetention.
+func (b *boltStore) AddWatchMatches(id string, matches []WatchMatch) error {
+	cutoff := time.Now().Add(-watchMatchRetention).UTC().Format(historyTimeFormat)
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketWatchMatches)
+		if err := deletePrefix(bucket, []byte(id+" "), cutoff); err != nil {
+			return err
+		}
+		for _, m := range matches {
+			key := id + " " + m.MatchedAt.UTC().Format(historyTimeFormat) + " " + m.Domain
+			if err := putJSON(bucket, key, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) WatchMatches(id string, since, until time.Time) ([]WatchMatch, error) {
+	var matches []WatchMatch
+	prefix := []byte(id + " ")
+	end := until.UTC().Format(historyTimeFormat)
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketWatchMatches).Cursor()
+		start := []byte(id + " " + since.UTC().Format(historyTimeFormat))
+		for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if string(k[len(prefix):len(prefix)+len(historyTimeFormat)]) > end {
+				break
+			}
+			var m WatchMatch
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			matches = append(matches, m)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// deletePrefix deletes the keys starting with prefix whose remainder sorts
+// before upTo, or all of them if upTo is empty.
+func deletePrefix(bucket *bolt.Bucket, prefix []byte, upTo string) error {
+	var keys [][]byte
+	c := bucket.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if upTo != "" && string(k[len(prefix):]) >= upTo {
+			break
+		}
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
+
+func recreateBucket(tx *bolt.Tx, name []byte) (*bolt.Bucket, error) {
+	if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+		return nil, err
+	}
+	return tx.CreateBucket(name)
+}
+
+func putJSON(bucket *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, path string) *boltStore {
+	t.Helper()
+
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore: %v", err)
+	}
+	return store
+}
+
+// TestBoltStoreRoundTrip writes everything a server persists, reopens the
+// file and reads it back.
+func TestBoltStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	shop, _ := parseDomain("shop.com")
+	shop.FirstSeen, shop.LastSeen, shop.CreatedAt = now.Add(-time.Hour), now, now.Add(-time.Hour)
+	shop.Sources = []string{"file:feed.txt"}
+	shop.Health = DomainHealth{IsOnline: true, StatusCode: 200} // stored by RecordHealth, not SaveState
+	shop.Risk = &Risk{Score: 42, Signals: []RiskSignal{{Signal: "tld", Points: 15, Detail: "test"}}}
+	bank, _ := parseDomain("bank.org")
+	bank.Sources = []string{"file:feed.txt"}
+	gone, _ := parseDomain("gone.net")
+
+	state := &StoredState{
+		Domains: []Domain{shop, bank},
+		Removed: []RemovedDomain{{Domain: gone, RemovedAt: now.Add(-time.Minute)}},
+		Seen: map[string]seenRecord{
+			"shop.com": {FirstSeen: shop.FirstSeen, LastSeen: now},
+			"gone.net": {FirstSeen: now.Add(-48 * time.Hour), LastSeen: now.Add(-time.Minute)},
+		},
+		LastUpdate: now,
+	}
+	health := []map[string]DomainHealth{
+		{"shop.com": {IsOnline: false, Error: "timeout"}},
+		{"shop.com": {IsOnline: true, Protocol: "https", StatusCode: 200, ResponseTime: 120 * time.Millisecond}},
+	}
+	whois := WhoisInfo{DomainName: "shop.com", Registrar: "Example Registrar"}
+	list := Watchlist{ID: "w1", Name: "Shops", Keywords: []string{"shop"}, CreatedAt: now, UpdatedAt: now}
+	match := WatchMatch{Domain: "shop.com", Reasons: []WatchReason{{Type: "keyword", Value: "shop"}}, MatchedAt: now}
+
+	store := openTestStore(t, path)
+	if err := store.SaveState(state); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	for i, h := range health {
+		if err := store.RecordHealth(now.Add(time.Duration(i)*time.Minute), h); err != nil {
+			t.Fatalf("RecordHealth: %v", err)
+		}
+	}
+	if err := store.PutLookup("whois:shop.com", whois); err != nil {
+		t.Fatalf("PutLookup: %v", err)
+	}
+	if err := store.SaveWatchlist(&list); err != nil {
+		t.Fatalf("SaveWatchlist: %v", err)
+	}
+	if err := store.AddWatchMatches(list.ID, []WatchMatch{match}); err != nil {
+		t.Fatalf("AddWatchMatches: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	store = openTestStore(t, path)
+	defer store.Close()
+
+	loaded, err := store.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if len(loaded.Domains) != 2 {
+		t.Fatalf("loaded %d domains, want 2", len(loaded.Domains))
+	}
+	byName := make(map[string]Domain)
+	for _, d := range loaded.Domains {
+		byName[d.Name] = d
+	}
+	got := byName["shop.com"]
+	if got.TLD != "com" || !got.FirstSeen.Equal(shop.FirstSeen) || len(got.Sources) != 1 || got.Risk == nil || got.Risk.Score != 42 {
+		t.Errorf("shop.com loaded as %+v", got)
+	}
+	if want := health[1]["shop.com"]; got.Health != want {
+		t.Errorf("shop.com health = %+v, want the latest check %+v", got.Health, want)
+	}
+	if h := byName["bank.org"].Health; h != (DomainHealth{}) {
+		t.Errorf("bank.org health = %+v, want none", h)
+	}
+	if len(loaded.Removed) != 1 || loaded.Removed[0].Name != "gone.net" || !loaded.Removed[0].RemovedAt.Equal(now.Add(-time.Minute)) {
+		t.Errorf("removed = %+v", loaded.Removed)
+	}
+	if len(loaded.Seen) != 2 || !loaded.Seen["gone.net"].FirstSeen.Equal(now.Add(-48*time.Hour)) {
+		t.Errorf("seen = %+v", loaded.Seen)
+	}
+	if !loaded.LastUpdate.Equal(now) {
+		t.Errorf("last update = %v, want %v", loaded.LastUpdate, now)
+	}
+
+	history, err := store.HealthHistory("shop.com")
+	if err != nil {
+		t.Fatalf("HealthHistory: %v", err)
+	}
+	if len(history) != 2 || history[0].Error != "timeout" || !history[1].CheckedAt.Equal(now.Add(time.Minute)) || history[1].ResponseTime != 120*time.Millisecond {
+		t.Errorf("history = %+v", history)
+	}
+
+	var info WhoisInfo
+	if ok, err := store.GetLookup("whois:shop.com", &info); !ok || err != nil || info.Registrar != whois.Registrar {
+		t.Errorf("GetLookup = %v, %v, %+v", ok, err, info)
+	}
+	if ok, _ := store.GetLookup("whois:bank.org", &info); ok {
+		t.Errorf("GetLookup found a lookup that was never stored")
+	}
+	var keys []string
+	store.ForEachLookup(func(key string, _ json.RawMessage) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if len(keys) != 1 || keys[0] != "whois:shop.com" {
+		t.Errorf("ForEachLookup keys = %v", keys)
+	}
+
+	lists, err := store.Watchlists()
+	if err != nil || len(lists) != 1 || lists[0].Name != "Shops" || !lists[0].CreatedAt.Equal(now) {
+		t.Errorf("Watchlists = %+v, %v", lists, err)
+	}
+	matches, err := store.WatchMatches(list.ID, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil || len(matches) != 1 || matches[0].Domain != "shop.com" || matches[0].Reasons[0].Value != "shop" {
+		t.Errorf("WatchMatches = %+v, %v", matches, err)
+	}
+	if matches, _ := store.WatchMatches(list.ID, now.Add(time.Minute), now.Add(time.Hour)); len(matches) != 0 {
+		t.Errorf("WatchMatches outside the range = %+v", matches)
+	}
+
+	// A smaller snapshot drops the health of domains no longer in it, and
+	// deleting a watchlist takes its matches with it
+	if err := store.SaveState(&StoredState{Domains: []Domain{bank}, LastUpdate: now}); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	if err := store.DeleteWatchlist(list.ID); err != nil {
+		t.Fatalf("DeleteWatchlist: %v", err)
+	}
+	loaded, err = store.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if len(loaded.Domains) != 1 || loaded.Domains[0].Name != "bank.org" || len(loaded.Removed) != 0 {
+		t.Errorf("after replacing the snapshot: %+v", loaded)
+	}
+	if lists, _ := store.Watchlists(); len(lists) != 0 {
+		t.Errorf("Watchlists after delete = %+v", lists)
+	}
+	if matches, _ := store.WatchMatches(list.ID, now.Add(-time.Hour), now.Add(time.Hour)); len(matches) != 0 {
+		t.Errorf("WatchMatches after delete = %+v", matches)
+	}
+
+	// shop.com's health went with it, so it comes back unchecked
+	if err := store.SaveState(state); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	loaded, err = store.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	for _, d := range loaded.Domains {
+		if d.Health != (DomainHealth{}) {
+			t.Errorf("%s health = %+v after it left the snapshot, want none", d.Name, d.Health)
+		}
+	}
+}
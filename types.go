@@ -7,16 +7,45 @@ import (
 )
 
 type Domain struct {
-	Name      string       `json:"name"`
-	TLD       string       `json:"tld"`
-	CreatedAt time.Time    `json:"created_at"`
-	Health    DomainHealth `json:"health"`
+	Name        string       `json:"name"`
+	Unicode     string       `json:"unicode,omitempty"` // decoded form of IDNs
+	Scripts     []string     `json:"scripts,omitempty"`
+	MixedScript bool         `json:"mixed_script,omitempty"`
+	TLD         string       `json:"tld"` // effective TLD, e.g. co.uk
+	Registrable string       `json:"registrable_domain"`
+	CreatedAt   time.Time    `json:"created_at"` // same as FirstSeen
+	FirstSeen   time.Time    `json:"first_seen"`
+	LastSeen    time.Time    `json:"last_seen"`
+	Health      DomainHealth `json:"health"`
+	Sources     []string     `json:"sources"`
+
+	// Set for domains discovered in Certificate Transparency logs
+	CertTimestamp *time.Time `json:"cert_timestamp,omitempty"`
+
+	// Closest configured brand, see -brands
+	BrandMatch *BrandMatch `json:"brand_match,omitempty"`
+	// Brand whose name this one is visually identical to
+	Confusable *ConfusableMatch `json:"confusable,omitempty"`
+	// Brand name combined with lure words, as in paypal-secure-login.com
+	Combo *ComboMatch `json:"combo,omitempty"`
+
+	Risk *Risk `json:"risk,omitempty"`
+}
+
+// RemovedDomain is a domain that dropped out of the feed.
+type RemovedDomain struct {
+	Domain
+	RemovedAt time.Time `json:"removed_at"`
 }
 
 type DomainStats struct {
 	TotalDomains   int            `json:"total_domains"`
 	DomainsPerTLD  map[string]int `json:"domains_per_tld"`
 	LastUpdateTime time.Time      `json:"last_update_time"`
+	LastAdded      int            `json:"last_added"`
+	LastRemoved    int            `json:"last_removed"`
+	LastCheckTime  time.Time      `json:"last_check_time"`
+	UnchangedSince time.Time      `json:"unchanged_since"` // last time any feed content changed
 }
 
 type gzipResponseWriter struct {
@@ -92,3 +121,20 @@ type DomainHealth struct {
 	ResponseTime time.Duration `json:"response_time,omitempty"`
 	Error        string        `json:"error,omitempty"`
 }
+
+// HealthRecord is one health check result in a domain's history.
+type HealthRecord struct {
+	CheckedAt time.Time `json:"checked_at"`
+	DomainHealth
+}
+
+type HealthHistory struct {
+	Domain        string         `json:"domain"`
+	Checks        []HealthRecord `json:"checks"`
+	Total         int            `json:"total_checks"`
+	Online        int            `json:"online_checks"`
+	UptimePercent float64        `json:"uptime_percent"`
+	Transitions   int            `json:"transitions"` // online/offline flips within the range
+	FirstOnline   *time.Time     `json:"first_online,omitempty"`
+	LastOnline    *time.Time     `json:"last_online,omitempty"`
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchMatchRetention is how long watchlist matches are kept.
+const watchMatchRetention = 90 * 24 * time.Hour
+
+// Watchlist is what a team wants to hear about among new domains. A domain
+// matches if it meets any of the criteria.
+type Watchlist struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Team     string   `json:"team,omitempty"`
+	Brands   []string `json:"brands,omitempty"`   // exact name under any TLD, or a homoglyph of it
+	Keywords []string `json:"keywords,omitempty"` // anywhere in the name
+	Regexes  []string `json:"regexes,omitempty"`  // RE2, as for mode=regex
+	// Lowest brand similarity score to match on, 0 to not score. Needs
+	// Brands.
+	Similarity float64   `json:"similarity,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WatchMatch is a new domain that matched a watchlist.
+type WatchMatch struct {
+	Domain    string        `json:"domain"`
+	Unicode   string        `json:"unicode,omitempty"`
+	Reasons   []WatchReason `json:"reasons"`
+	MatchedAt time.Time     `json:"matched_at"`
+}
+
+// WatchReason is a criterion a domain met.
+type WatchReason struct {
+	Type  string  `json:"type"`  // brand, homoglyph, similarity, keyword or regex
+	Value string  `json:"value"` // the brand, keyword or regex
+	Score float64 `json:"score,omitempty"`
+}
+
+// compiledWatchlist is a Watchlist ready to match domains against.
+type compiledWatchlist struct {
+	Watchlist
+	brands  []Brand
+	regexes []*regexp.Regexp
+}
+
+// compile checks w and normalizes its brands and keywords.
+func (w Watchlist) compile() (*compiledWatchlist, error) {
+	w.Name = strings.TrimSpace(w.Name)
+	if w.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len(w.Brands) == 0 && len(w.Keywords) == 0 && len(w.Regexes) == 0 {
+		return nil, fmt.Errorf("at least one of brands, keywords or regexes is required")
+	}
+	if w.Similarity != 0 && (w.Similarity < brandMinScore || w.Similarity > 100) {
+		return nil, fmt.Errorf("similarity must be between %d and 100", brandMinScore)
+	}
+	if w.Similarity != 0 && len(w.Brands) == 0 {
+		return nil, fmt.Errorf("similarity needs brands to compare against")
+	}
+
+	c := &compiledWatchlist{}
+	brands := make([]string, 0, len(w.Brands))
+	for _, v := range w.Brands {
+		brand, err := parseBrand(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid brand %q: %v", v, err)
+		}
+		c.brands = append(c.brands, brand)
+		brands = append(brands, brand.Domain)
+	}
+	w.Brands = brands
+
+	keywords := make([]string, 0, len(w.Keywords))
+	for _, v := range w.Keywords {
+		keyword := strings.ToLower(strings.TrimSpace(v))
+		if keyword == "" {
+			return nil, fmt.Errorf("keywords can't be empty")
+		}
+		keywords = append(keywords, keyword)
+	}
+	w.Keywords = keywords
+
+	for _, v := range w.Regexes {
+		re, err := compileLimitedRegex(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", v, err)
+		}
+		c.regexes = append(c.regexes, re)
+	}
+
+	c.Watchlist = w
+	return c, nil
+}
+
+// match returns why d matches the watchlist, or nil if it doesn't.
+func (c *compiledWatchlist) match(d *Domain) []WatchReason {
+	var reasons []WatchReason
+	label := nameLabel(d)
+
+	for _, brand := range c.brands {
+		if label == brand.Label && d.Name != brand.Domain {
+			reasons = append(reasons, WatchReason{Type: "brand", Value: brand.Domain})
+		}
+	}
+	if m := matchConfusable(d, c.brands); m != nil {
+		reasons = append(reasons, WatchReason{Type: "homoglyph", Value: m.Brand})
+	}
+	if c.Similarity > 0 {
+		if m := matchBrand(d, c.brands); m != nil && m.Score >= c.Similarity {
+			reasons = append(reasons, WatchReason{Type: "similarity", Value: m.Brand, Score: m.Score})
+		}
+	}
+
+	for _, keyword := range c.Keywords {
+		if strings.Contains(d.Name, keyword) || strings.Contains(d.Unicode, keyword) {
+			reasons = append(reasons, WatchReason{Type: "keyword", Value: keyword})
+		}
+	}
+	for _, re := range c.regexes {
+		if re.MatchString(d.Name) || (d.Unicode != "" && re.MatchString(d.Unicode)) {
+			reasons = append(reasons, WatchReason{Type: "regex", Value: re.String()})
+		}
+	}
+	return reasons
+}
+
+func newWatchlistID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// loadWatchlists reads the stored watchlists. It runs after -confusables is
+// loaded so brand skeletons use the same table as matchConfusable.
+func (s *Server) loadWatchlists() error {
+	stored, err := s.store.Watchlists()
+	if err != nil {
+		return err
+	}
+
+	watchlists := make(map[string]*compiledWatchlist, len(stored))
+	for _, w := range stored {
+		c, err := w.compile()
+		if err != nil {
+			log.Printf("Skipping watchlist %s: %v", w.ID, err)
+			continue
+		}
+		watchlists[w.ID] = c
+	}
+
+	s.watchMu.Lock()
+	s.watchlists = watchlists
+	s.watchMu.Unlock()
+	return nil
+}
+
+// listWatchlists returns every watchlist, ordered by name.
+func (s *Server) listWatchlists() []Watchlist {
+	s.watchMu.RLock()
+	list := make([]Watchlist, 0, len(s.watchlists))
+	for _, c := range s.watchlists {
+		list = append(list, c.Watchlist)
+	}
+	s.watchMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func (s *Server) getWatchlist(id string) (Watchlist, bool) {
+	s.watchMu.RLock()
+	defer s.watchMu.RUnlock()
+
+	c, ok := s.watchlists[id]
+	if !ok {
+		return Watchlist{}, false
+	}
+	return c.Watchlist, true
+}
+
+// saveWatchlist stores c and starts matching new domains against it.
+func (s *Server) saveWatchlist(c *compiledWatchlist) error {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	if err := s.store.SaveWatchlist(&c.Watchlist); err != nil {
+		return err
+	}
+	s.watchlists[c.ID] = c
+	return nil
+}
+
+// deleteWatchlist removes a watchlist along with its matches. It reports
+// false if there was no such watchlist.
+func (s *Server) deleteWatchlist(id string) (bool, error) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	if _, ok := s.watchlists[id]; !ok {
+		return false, nil
+	}
+	if err := s.store.DeleteWatchlist(id); err != nil {
+		return true, err
+	}
+	delete(s.watchlists, id)
+	return true, nil
+}
+
+// evaluateWatchlists matches the domains added by a fetch against every
+// watchlist and stores the matches.
+func (s *Server) evaluateWatchlists(added []Domain, now time.Time) {
+	s.watchMu.RLock()
+	watchlists := make([]*compiledWatchlist, 0, len(s.watchlists))
+	for _, c := range s.watchlists {
+		watchlists = append(watchlists, c)
+	}
+	s.watchMu.RUnlock()
+
+	for _, c := range watchlists {
+		var matches []WatchMatch
+		for i := range added {
+			if reasons := c.match(&added[i]); reasons != nil {
+				matches = append(matches, WatchMatch{
+					Domain:    added[i].Name,
+					Unicode:   added[i].Unicode,
+					Reasons:   reasons,
+					MatchedAt: now,
+				})
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		if err := s.addWatchMatches(c.ID, matches); err != nil {
+			log.Printf("Error storing matches for watchlist %s: %v", c.ID, err)
+			continue
+		}
+		log.Printf("Watchlist %q matched %d new domains", c.Name, len(matches))
+	}
+}
+
+// addWatchMatches stores matches unless the watchlist was deleted while
+// they were being found.
+func (s *Server) addWatchMatches(id string, matches []WatchMatch) error {
+	s.watchMu.RLock()
+	defer s.watchMu.RUnlock()
+
+	if _, ok := s.watchlists[id]; !ok {
+		return nil
+	}
+	return s.store.AddWatchMatches(id, matches)
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// zoneSource derives newly registered and dropped domains from consecutive
+// RFC 1035 master zone files, as downloaded from ICANN CZDS. The directory
+// holds snapshots of a single zone (com.txt.gz, then the next day's, ...);
+// the two most recently modified files are diffed.
+//
+// Delegated names are extracted once per snapshot into a sorted list under
+// .names/ in the same directory, and the diff of each pair of snapshots is
+// cached there too, so only a new download costs a full parse.
+type zoneSource struct {
+	dirSource
+
+	mu       sync.Mutex
+	lastKey  string
+	lastPair string          // file names of the last diffed pair
+	reported map[string]bool // drops already reported for lastPair
+	dropped  []string
+}
+
+func (z *zoneSource) Name() string {
+	return "zone:" + z.path
+}
+
+func (z *zoneSource) cacheDir() string {
+	return filepath.Join(z.path, ".names")
+}
+
+func (z *zoneSource) Open() (io.ReadCloser, error) {
+	files, err := z.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) < 2 {
+		log.Printf("%s: need two zone snapshots to diff, have %d", z.Name(), len(files))
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	prev, cur := files[len(files)-2], files[len(files)-1]
+
+	if err := os.MkdirAll(z.cacheDir(), 0o755); err != nil {
+		return nil, err
+	}
+
+	prevNames, err := z.names(prev)
+	if err != nil {
+		return nil, err
+	}
+	curNames, err := z.names(cur)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.TrimSuffix(filepath.Base(prevNames), ".names") + "__" + strings.TrimSuffix(filepath.Base(curNames), ".names")
+	addedPath := filepath.Join(z.cacheDir(), key+".added")
+	droppedPath := filepath.Join(z.cacheDir(), key+".dropped")
+
+	if !fileExists(addedPath) || !fileExists(droppedPath) {
+		if err := diffSortedFiles(prevNames, curNames, addedPath, droppedPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Drops are only reported the first time a pair is diffed, otherwise
+	// every refresh would record them as removed again, and a snapshot
+	// overwritten in place only adds the drops not reported yet. A pair
+	// whose drops couldn't be read is tried again next time.
+	z.mu.Lock()
+	if key != z.lastKey {
+		var dropped []string
+		if dropped, err = readLines(droppedPath); err == nil {
+			pair := prev.Name() + "__" + cur.Name()
+			if pair != z.lastPair {
+				z.lastPair, z.reported = pair, make(map[string]bool)
+			}
+			z.lastKey = key
+			for _, name := range dropped {
+				if !z.reported[name] {
+					z.reported[name] = true
+					z.dropped = append(z.dropped, name)
+				}
+			}
+		}
+	}
+	z.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(addedPath)
+}
+
+// Dropped returns the names deleted from the zone by the most recent diff and
+// forgets them.
+func (z *zoneSource) Dropped() []string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	dropped := z.dropped
+	z.dropped = nil
+	return dropped
+}
+
+// names returns the path of the sorted delegated-name list for a snapshot,
+// extracting it if it doesn't exist yet. The list is keyed by the snapshot's
+// size and modification time as well as its name, so a snapshot overwritten
+// in place is extracted again.
+func (z *zoneSource) names(info os.FileInfo) (string, error) {
+	version := fmt.Sprintf("%s.%d-%d", info.Name(), info.Size(), info.ModTime().UnixNano())
+	path := filepath.Join(z.cacheDir(), version+".names")
+	if fileExists(path) {
+		return path, nil
+	}
+
+	// Lists of earlier versions of this snapshot are stale now
+	if stale, err := filepath.Glob(filepath.Join(z.cacheDir(), info.Name()+".*.names")); err == nil {
+		for _, old := range stale {
+			os.Remove(old)
+		}
+	}
+
+	log.Printf("%s: extracting delegations from %s", z.Name(), info.Name())
+
+	f, err := os.Open(filepath.Join(z.path, info.Name()))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(info.Name(), ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", info.Name(), err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	names, err := zoneDelegations(r)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", info.Name(), err)
+	}
+
+	return path, writeLines(path, names)
+}
+
+// zoneDelegations parses an RFC 1035 master file and returns the sorted,
+// de-duplicated owner names of every NS record below the zone apex.
+func zoneDelegations(r io.Reader) ([]string, error) {
+	var (
+		origin  string
+		apex    string
+		owner   string
+		pending []string
+		depth   int
+		seen    = make(map[string]struct{})
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		startsBlank := depth == 0 && len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+
+		fields, d := zoneFields(line)
+		if depth == 0 && startsBlank && len(fields) > 0 {
+			// Owner omitted, the previous one applies
+			fields = append([]string{""}, fields...)
+		}
+		pending = append(pending, fields...)
+		depth += d
+		if depth > 0 || len(pending) == 0 {
+			continue
+		}
+
+		fields, pending = pending, nil
+
+		switch strings.ToUpper(fields[0]) {
+		case "$ORIGIN":
+			if len(fields) > 1 {
+				origin = absoluteName(fields[1], origin)
+			}
+			continue
+		case "$TTL", "$INCLUDE", "$GENERATE":
+			continue
+		}
+
+		if fields[0] != "" {
+			owner = absoluteName(fields[0], origin)
+		}
+
+		rrType := recordType(fields[1:])
+		switch rrType {
+		case "SOA":
+			if origin == "" {
+				origin = owner
+			}
+			if apex == "" {
+				apex = owner
+			}
+		case "NS":
+			// The apex is the SOA's owner, $ORIGIN may move below it
+			top := apex
+			if top == "" {
+				top = origin
+			}
+			if owner != top && owner != "" {
+				seen[owner] = struct{}{}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// zoneFields splits a master file line into fields, dropping comments and
+// parentheses, and returns the change in parenthesis depth.
+func zoneFields(line string) ([]string, int) {
+	var (
+		fields []string
+		field  strings.Builder
+		depth  int
+		quoted bool
+	)
+
+	flush := func() {
+		if field.Len() > 0 {
+			fields = append(fields, field.String())
+			field.Reset()
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+			field.WriteByte(c)
+		case quoted:
+			field.WriteByte(c)
+		case c == ';':
+			flush()
+			return fields, depth
+		case c == '(':
+			flush()
+			depth++
+		case c == ')':
+			flush()
+			depth--
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	flush()
+
+	return fields, depth
+}
+
+// recordType skips the optional TTL and class fields (in either order) and
+// returns the record type.
+func recordType(fields []string) string {
+	for _, f := range fields {
+		upper := strings.ToUpper(f)
+		switch {
+		case upper == "IN" || upper == "CH" || upper == "HS" || upper == "CS":
+			continue
+		case f[0] >= '0' && f[0] <= '9':
+			continue
+		}
+		return upper
+	}
+	return ""
+}
+
+// absoluteName lowercases a zone file name, resolves it against origin and
+// returns it without the trailing dot.
+func absoluteName(name, origin string) string {
+	name = strings.ToLower(name)
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.TrimSuffix(name, ".")
+	case origin == "":
+		return name
+	}
+	return name + "." + origin
+}
+
+// diffSortedFiles merges two sorted name lists and writes the names only in
+// cur to addedPath and the names only in prev to droppedPath.
+func diffSortedFiles(prevPath, curPath, addedPath, droppedPath string) error {
+	prevFile, err := os.Open(prevPath)
+	if err != nil {
+		return err
+	}
+	defer prevFile.Close()
+
+	curFile, err := os.Open(curPath)
+	if err != nil {
+		return err
+	}
+	defer curFile.Close()
+
+	var added, dropped []string
+	prev, cur := bufio.NewScanner(prevFile), bufio.NewScanner(curFile)
+	hasPrev, hasCur := prev.Scan(), cur.Scan()
+
+	for hasPrev || hasCur {
+		switch {
+		case !hasPrev || (hasCur && cur.Text() < prev.Text()):
+			added = append(added, cur.Text())
+			hasCur = cur.Scan()
+		case !hasCur || prev.Text() < cur.Text():
+			dropped = append(dropped, prev.Text())
+			hasPrev = prev.Scan()
+		default:
+			hasPrev, hasCur = prev.Scan(), cur.Scan()
+		}
+	}
+	if err := prev.Err(); err != nil {
+		return err
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	// Both lists are written in full before either is renamed into place,
+	// and the added list goes last since its presence marks the diff as
+	// complete
+	droppedTmp, err := writeTemp(filepath.Dir(droppedPath), dropped)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(droppedTmp)
+	addedTmp, err := writeTemp(filepath.Dir(addedPath), added)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(addedTmp)
+
+	if err := os.Rename(droppedTmp, droppedPath); err != nil {
+		return err
+	}
+	return os.Rename(addedTmp, addedPath)
+}
+
+// writeLines writes lines to path atomically.
+func writeLines(path string, lines []string) error {
+	tmp, err := writeTemp(filepath.Dir(path), lines)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	return os.Rename(tmp, path)
+}
+
+// writeTemp writes lines to a new temporary file in dir and returns its path.
+func writeTemp(dir string, lines []string) (string, error) {
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZoneDelegations(t *testing.T) {
+	zone := `$ORIGIN com.
+$TTL 86400
+@	IN	SOA	a.gtld-servers.net. nstld.verisign-grs.com. (
+			1700000000 ; serial
+			1800       ; refresh
+			900 604800 86400 )
+@	IN	NS	a.gtld-servers.net.
+EXAMPLE	172800	IN	NS	ns1.example.net.
+	172800	IN	NS	ns2.example.net.  ; continuation, owner is example
+shop IN NS ( ns1.shop.net.
+	)
+bank in ns ns1.bank.net.
+bank.com. 3600 ns ns2.bank.net.
+a.gtld-servers.net. IN A 192.0.2.1
+nodelegation IN A 192.0.2.2
+$ORIGIN sub.com.
+deep	IN	NS	ns.deep.net.
+	IN	NS	ns2.deep.net.
+@	IN	NS	ns.sub.net.
+txt IN TXT "not a ( delegation" ; quoted parenthesis
+`
+	names, err := zoneDelegations(strings.NewReader(zone))
+	if err != nil {
+		t.Fatalf("zoneDelegations: %v", err)
+	}
+	want := []string{"bank.com", "deep.sub.com", "example.com", "shop.com", "sub.com"}
+	if !slices.Equal(names, want) {
+		t.Errorf("zoneDelegations = %v, want %v", names, want)
+	}
+}
+
+func TestDiffSortedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	if err := writeLines(path("prev"), []string{"a.com", "b.com", "d.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeLines(path("cur"), []string{"a.com", "c.com", "d.com", "e.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := diffSortedFiles(path("prev"), path("cur"), path("added"), path("dropped")); err != nil {
+		t.Fatalf("diffSortedFiles: %v", err)
+	}
+
+	added, _ := readLines(path("added"))
+	dropped, _ := readLines(path("dropped"))
+	if !slices.Equal(added, []string{"c.com", "e.com"}) || !slices.Equal(dropped, []string{"b.com"}) {
+		t.Errorf("added %v, dropped %v, want [c.com e.com] and [b.com]", added, dropped)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 4 {
+		t.Errorf("left %d files behind, want only the inputs and the two lists", len(entries))
+	}
+}
+
+// TestZoneSource feeds successive snapshots to a server and checks that
+// zone domains are only removed when a diff reports them dropped.
+func TestZoneSource(t *testing.T) {
+	dir := t.TempDir()
+	src, err := ParseSource("zone:" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, src)
+
+	base := time.Now().Add(-time.Hour)
+	write := func(i int, names ...string) {
+		t.Helper()
+		var b strings.Builder
+		b.WriteString("$ORIGIN com.\n@ IN SOA ns. host. 1 2 3 4 5\n")
+		for _, name := range names {
+			b.WriteString(name + " IN NS ns1.example.net.\n")
+		}
+		path := filepath.Join(dir, "com.zone."+string(rune('0'+i)))
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(path, mtime, mtime)
+	}
+	check := func(wantDomains, wantRemoved []string) {
+		t.Helper()
+		if err := s.fetchData(); err != nil {
+			t.Fatalf("fetchData: %v", err)
+		}
+		var domains, removed []string
+		for _, d := range s.domains {
+			domains = append(domains, d.Name)
+		}
+		for _, d := range s.removed {
+			removed = append(removed, d.Name)
+		}
+		slices.Sort(domains)
+		if !slices.Equal(domains, wantDomains) || !slices.Equal(removed, wantRemoved) {
+			t.Errorf("domains %v, removed %v, want %v and %v", domains, removed, wantDomains, wantRemoved)
+		}
+	}
+
+	write(0, "a", "b")
+	check(nil, nil)
+	write(1, "a", "b", "c")
+	check([]string{"c.com"}, nil)
+	// c.com is no longer new, but it's still delegated
+	write(2, "a", "b", "c", "d")
+	check([]string{"d.com"}, nil)
+	write(3, "a", "c", "d")
+	check(nil, []string{"b.com"})
+	// A refresh without a new snapshot doesn't report b.com again
+	check(nil, []string{"b.com"})
+
+	// A snapshot overwritten in place is extracted again
+	write(3, "a", "c", "d", "e")
+	check([]string{"e.com"}, []string{"b.com"})
+}